@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// apiPrefix is where the current management API is served. Breaking changes
+// get a new version prefix rather than altering this one.
+const apiPrefix = "/api/v1"
+
+// legacyAPIPrefix is the unversioned prefix the API was first served under.
+// It still answers, marked deprecated, so existing scripts keep working.
+const legacyAPIPrefix = "/api"
+
+// apiRoute describes one management endpoint. The same table registers the
+// handlers and generates /api/v1/openapi.json, so the two can't drift apart.
+type apiRoute struct {
+	Method  string
+	Path    string // ServeMux path below apiPrefix, with {wildcards}
+	Summary string
+	Params  []apiParam
+	// Body and Response are zero values of the JSON request and response
+	// types. A nil Response documents an empty reply with Status.
+	Body     any
+	Response any
+	// BodyType and ResponseType override the application/json media type
+	BodyType     string
+	ResponseType string
+	Status       int // success status, default 200
+	Admin        bool
+	Public       bool // open to anyone, for logging in; others need routeRole
+	Audit        bool // record calls in the audit log although they only read
+	// BinScoped routes act on no more than one bin, named by ?bin= or
+	// {token}, or one capture, so the bin's credentials or share link are
+	// enough to call them
+	BinScoped bool
+	// AnyMethod registers Path for every method, for handlers that predate
+	// method patterns and check r.Method themselves
+	AnyMethod bool
+	Handler   http.HandlerFunc
+}
+
+// apiParam is a query or path parameter. Type is an OpenAPI primitive type,
+// or "array" for a repeatable string parameter.
+type apiParam struct {
+	Name        string
+	In          string
+	Type        string
+	Description string
+}
+
+var pageParams = []apiParam{
+	{"limit", "query", "integer", "Maximum number of requests to return, at most 1000"},
+	{"offset", "query", "integer", "Number of matching requests to skip"},
+}
+
+var filterParams = []apiParam{
+	{"bin", "query", "string", "Token of the /b/{token} bin the requests were sent to; created bins also need their read token, password or a ?share= link"},
+	{"method", "query", "string", "HTTP method, case insensitive"},
+	{"path", "query", "string", "URL path prefix"},
+	{"from", "query", "string", "Inclusive start time, RFC 3339 or Unix seconds"},
+	{"to", "query", "string", "Exclusive end time, RFC 3339 or Unix seconds"},
+	{"tag", "query", "array", "Tag the request must carry; may repeat"},
+	{"param", "query", "array", "Query parameter the request must carry, as name or name=value; may repeat"},
+	{"field", "query", "array", "Form body field the request must carry, as name or name=value; may repeat"},
+	{"agent", "query", "string", "User-Agent product, such as GitHub-Hookshot, case insensitive"},
+	{"operation", "query", "string", "GraphQL operation name, or query, mutation or subscription for every operation of that type"},
+	{"event_type", "query", "string", "CloudEvents type, such as com.example.order.created"},
+	{"detected_type", "query", "string", "Body type sniffed from its content: json, xml, form, binary or text"},
+	{"since_id", "query", "integer", "Only requests with a greater ID"},
+}
+
+var listParams = params(filterParams, pageParams, []apiParam{
+	{"sort", "query", "string", "timestamp (default), size or method"},
+	{"order", "query", "string", "asc or desc; default desc, or asc for method"},
+	{"full", "query", "boolean", "Return full bodies instead of spilled previews"},
+})
+
+var includePinnedParam = apiParam{"include_pinned", "query", "boolean", "Remove pinned requests too"}
+
+// params joins parameter lists into a fresh slice
+func params(lists ...[]apiParam) []apiParam {
+	var out []apiParam
+	for _, l := range lists {
+		out = append(out, l...)
+	}
+	return out
+}
+
+// apiRoutes returns every management endpoint in registration order
+func apiRoutes() []apiRoute {
+	return []apiRoute{
+		{Method: "GET", Path: "/requests", Summary: "List captured requests, newest first",
+			Params: listParams, Response: []RequestInfo{}, AnyMethod: true, BinScoped: true, Handler: getRequestsHandler},
+
+		{Method: "GET", Path: "/requests/{id}", Summary: "Get one request with its full body",
+			Response: RequestInfo{}, BinScoped: true, Handler: getRequestHandler},
+		{Method: "PATCH", Path: "/requests/{id}", Summary: "Update a request's notes, tags or pin",
+			Body: requestPatch{}, Response: RequestInfo{}, BinScoped: true, Handler: patchRequestHandler},
+		{Method: "DELETE", Path: "/requests/{id}", Summary: "Delete one request",
+			Status: http.StatusNoContent, BinScoped: true, Handler: deleteRequestHandler},
+
+		{Method: "GET", Path: "/requests/{id}/curl", Summary: "Render a request as a curl command",
+			Params:   []apiParam{{"target", "query", "string", "Scheme and host to send the request to instead of this server"}},
+			Response: "", ResponseType: "text/plain", BinScoped: true, Handler: curlHandler},
+
+		{Method: "GET", Path: "/requests/{id}/body", Summary: "Download a request's body as received, decompressed",
+			Response: "", ResponseType: "application/octet-stream", BinScoped: true, Handler: requestBodyHandler},
+		{Method: "GET", Path: "/requests/{id}/raw", Summary: "Download a request in wire format, recorded with --raw-dump",
+			Response: "", ResponseType: "message/http", BinScoped: true, Handler: requestRawHandler},
+		{Method: "GET", Path: "/requests/{id}/files/{index}", Summary: "Download a file uploaded in a multipart request",
+			Response: "", ResponseType: "application/octet-stream", BinScoped: true, Handler: requestFileHandler},
+
+		{Method: "GET", Path: "/requests/count", Summary: "Count requests matching a filter",
+			Params: filterParams, Response: countResponse{}, BinScoped: true, Handler: countRequestsHandler},
+
+		{Method: "GET", Path: "/requests/export", Summary: "Stream matching requests as NDJSON or HAR",
+			Params:   params(filterParams, []apiParam{{"format", "query", "string", "ndjson (default) or har"}}),
+			Response: RequestInfo{}, ResponseType: "application/x-ndjson", Audit: true, BinScoped: true, Handler: streamExportHandler},
+
+		{Method: "GET", Path: "/requests/distinct", Summary: "Unique values of a field with their counts",
+			Params: params([]apiParam{
+				{"field", "query", "string", "path, remote_addr or method"},
+			}, filterParams),
+			Response: []valueCount{}, BinScoped: true, Handler: distinctHandler},
+
+		{Method: "GET", Path: "/requests/wait", Summary: "Wait for the next request matching a filter",
+			Params: params([]apiParam{
+				{"timeout", "query", "string", "How long to wait, such as 30s (default) or 2m; at most 5m"},
+				{"match", "query", "string", "Case-insensitive substring of the body, headers or URL"},
+			}, filterParams),
+			Response: RequestInfo{}, BinScoped: true, Handler: waitHandler},
+
+		{Method: "GET", Path: "/stream", Summary: "Server-Sent Events stream of new requests",
+			Params: filterParams, Response: "", ResponseType: "text/event-stream", BinScoped: true, Handler: streamHandler},
+
+		{Method: "GET", Path: "/ws", Summary: "WebSocket stream of new, updated and deleted requests",
+			Params: filterParams, Status: http.StatusSwitchingProtocols, BinScoped: true, Handler: wsHandler},
+
+		{Method: "POST", Path: "/requests/delete", Summary: "Delete every request matching a filter",
+			Params: params(filterParams, []apiParam{includePinnedParam}), Response: deleteResponse{}, BinScoped: true, Handler: bulkDeleteHandler},
+
+		{Method: "GET", Path: "/search", Summary: "Search bodies, headers and URLs",
+			Params: params([]apiParam{
+				{"q", "query", "string", "Search term"},
+				{"regex", "query", "boolean", "Treat q as a regular expression"},
+				{"fields", "query", "string", "Comma separated subset of body, headers and url"},
+			}, listParams),
+			Response: []RequestInfo{}, AnyMethod: true, BinScoped: true, Handler: searchHandler},
+
+		{Method: "GET", Path: "/diff", Summary: "Compare the headers and bodies of two requests",
+			Params: []apiParam{
+				{"a", "query", "integer", "ID of the first request"},
+				{"b", "query", "integer", "ID of the second request"},
+			},
+			Response: requestDiff{}, BinScoped: true, Handler: diffHandler},
+
+		{Method: "GET", Path: "/stats", Summary: "Aggregate statistics over matching requests",
+			Params:   params([]apiParam{{"top", "query", "integer", "Number of top paths and sources, default 10"}}, filterParams),
+			Response: Stats{}, AnyMethod: true, BinScoped: true, Handler: statsHandler},
+		{Method: "GET", Path: "/stats/timeseries", Summary: "Count matching requests per time bucket",
+			Params:   params([]apiParam{{"bucket", "query", "string", "Bucket width such as 30s or 5m, default 1m"}}, filterParams),
+			Response: []bucketCount{}, AnyMethod: true, BinScoped: true, Handler: timeseriesHandler},
+
+		{Method: "POST", Path: "/clear", Summary: "Remove every request except pinned ones",
+			Params: []apiParam{includePinnedParam, {"bin", "query", "string", "Only clear this bin"}}, AnyMethod: true, BinScoped: true, Handler: clearRequestsHandler},
+
+		{Method: "GET", Path: "/export", Summary: "Download the whole history as one archive",
+			Params:   []apiParam{{"bin", "query", "string", "Only export this bin"}},
+			Response: Archive{}, AnyMethod: true, Audit: true, BinScoped: true, Handler: exportHandler},
+		{Method: "POST", Path: "/import", Summary: "Import an archive",
+			Params: []apiParam{{"replace", "query", "boolean", "Clear the existing history first, except protected bins"}},
+			Body:   Archive{}, Response: importResponse{}, AnyMethod: true, Handler: importHandler},
+		{Method: "GET", Path: "/export/postman", Summary: "Export matching requests as a Postman collection",
+			Params: filterParams, Response: postmanCollection{}, Audit: true, BinScoped: true, Handler: postmanExportHandler},
+
+		{Method: "POST", Path: "/signup", Summary: "Create an account and log in",
+			Body: loginInput{}, Response: sessionResponse{}, Status: http.StatusCreated, Public: true, Handler: signupHandler},
+		{Method: "POST", Path: "/login", Summary: "Log in, setting a session cookie and returning the same token for bearer use",
+			Body: loginInput{}, Response: sessionResponse{}, Public: true, Handler: loginHandler},
+		{Method: "POST", Path: "/logout", Summary: "Drop the session cookie",
+			Status: http.StatusNoContent, Public: true, Handler: logoutHandler},
+		{Method: "GET", Path: "/me", Summary: "The logged-in user",
+			Response: User{}, Public: true, Handler: meHandler},
+		{Method: "POST", Path: "/token", Summary: "Issue a bearer token for the logged-in user",
+			Response: sessionResponse{}, Public: true, Handler: tokenHandler},
+		{Method: "GET", Path: "/oauth/providers", Summary: "Names of the configured login providers",
+			Response: []string{}, Public: true, Handler: oauthProvidersHandler},
+		{Method: "GET", Path: "/oauth/{provider}/login", Summary: "Start logging in through a provider",
+			Params: []apiParam{{"next", "query", "string", "Path to return to afterwards, default the account page"}},
+			Status: http.StatusFound, Public: true, Handler: oauthLoginHandler},
+		{Method: "GET", Path: "/oauth/{provider}/callback", Summary: "Where a provider returns to after login",
+			Status: http.StatusFound, Public: true, Handler: oauthCallbackHandler},
+
+		{Method: "GET", Path: "/bins", Summary: "List the logged-in user's bins",
+			Response: []Bin{}, Public: true, Handler: listBinsHandler},
+		{Method: "POST", Path: "/bins", Summary: "Create a bin with a random token and return its URLs",
+			Body: binInput{}, Response: binResponse{}, Status: http.StatusCreated, Handler: createBinHandler},
+
+		{Method: "PATCH", Path: "/bins/{token}", Summary: "Change how a bin answers its webhooks",
+			Body: binPatch{}, Response: Bin{}, BinScoped: true, Handler: patchBinHandler},
+
+		{Method: "POST", Path: "/shares", Summary: "Create a time-limited, read-only link to a bin or one capture",
+			Body: shareInput{}, Response: shareResponse{}, Status: http.StatusCreated, BinScoped: true, Handler: createShareHandler},
+
+		{Method: "GET", Path: "/notifications", Summary: "List registered notification URLs",
+			Response: []notificationHook{}, BinScoped: true, Handler: listNotificationsHandler},
+		{Method: "POST", Path: "/notifications", Summary: "Register a URL to be sent a summary of matching captures",
+			Body: notificationInput{}, Response: notificationHook{}, Status: http.StatusCreated, BinScoped: true, Handler: createNotificationHandler},
+		{Method: "DELETE", Path: "/notifications/{id}", Summary: "Remove a notification URL",
+			Status: http.StatusNoContent, BinScoped: true, Handler: deleteNotificationHandler},
+
+		{Method: "GET", Path: "/rules", Summary: "List the rules answering matching webhooks, in the order they're tried",
+			Response: []Rule{}, BinScoped: true, Handler: listRulesHandler},
+		{Method: "POST", Path: "/rules", Summary: "Add a rule answering matching webhooks with a canned response",
+			Body: Rule{}, Response: Rule{}, Status: http.StatusCreated, BinScoped: true, Handler: createRuleHandler},
+		{Method: "GET", Path: "/rules/{id}", Summary: "Get a rule",
+			Response: Rule{}, BinScoped: true, Handler: getRuleHandler},
+		{Method: "PUT", Path: "/rules/{id}", Summary: "Replace a rule, keeping its place in the order",
+			Body: Rule{}, Response: Rule{}, BinScoped: true, Handler: updateRuleHandler},
+		{Method: "DELETE", Path: "/rules/{id}", Summary: "Remove a rule",
+			Status: http.StatusNoContent, BinScoped: true, Handler: deleteRuleHandler},
+
+		{Method: "GET", Path: "/admin/backup", Summary: "Download a backup tarball",
+			Response: "", ResponseType: "application/gzip", Admin: true, AnyMethod: true, Audit: true, Handler: backupHandler},
+		{Method: "POST", Path: "/admin/restore", Summary: "Replace the history with a backup tarball",
+			BodyType: "application/gzip", Response: restoreResponse{}, Admin: true, AnyMethod: true, Handler: restoreHandler},
+
+		{Method: "GET", Path: "/admin/bins", Summary: "List every bin, created or just used, with its usage",
+			Response: []binUsage{}, Admin: true, Handler: adminListBinsHandler},
+		{Method: "PATCH", Path: "/admin/bins/{token}", Summary: "Rename a bin or change when it expires",
+			Body: binAdminPatch{}, Response: Bin{}, Admin: true, Handler: adminPatchBinHandler},
+		{Method: "DELETE", Path: "/admin/bins/{token}", Summary: "Delete a bin and all its captures",
+			Response: deleteResponse{}, Admin: true, Handler: adminDeleteBinHandler},
+
+		{Method: "GET", Path: "/users", Summary: "List accounts with their roles",
+			Response: []User{}, Admin: true, Handler: listUsersHandler},
+		{Method: "PATCH", Path: "/users/{id}", Summary: "Change an account's role",
+			Body: userPatch{}, Response: User{}, Admin: true, Handler: patchUserHandler},
+
+		{Method: "GET", Path: "/audit", Summary: "Changes made through the API and exports, newest first",
+			Params: []apiParam{
+				{"limit", "query", "integer", "Maximum number of entries to return, default 100, at most 1000"},
+				{"offset", "query", "integer", "Number of entries to skip"},
+				{"actor", "query", "string", "Only entries by this user name, \"admin token\", \"bin <token>\" or \"anonymous\""},
+				{"action", "query", "string", "Only entries of this operation, such as clearRequests"},
+				{"bin", "query", "string", "Only entries scoped to this bin"},
+			},
+			Response: []AuditEntry{}, Admin: true, Handler: auditHandler},
+
+		{Method: "GET", Path: "/openapi.json", Summary: "This document",
+			Response: map[string]any{}, Public: true, Handler: openAPIHandler},
+	}
+}
+
+// registerAPI adds the management endpoints to mux under apiPrefix, and
+// under legacyAPIPrefix as deprecated aliases
+func registerAPI(mux *http.ServeMux) {
+	for _, rt := range apiRoutes() {
+		h := requireRole(routeRole(rt), rt.BinScoped, requireBinToken(rt.Handler))
+		if audited(rt) {
+			h = auditCalls(operationID(rt), h)
+		}
+		current, legacy := routePatterns(rt)
+		mux.HandleFunc(current, h)
+		mux.HandleFunc(legacy, deprecatedAPI(h))
+	}
+	// Unknown versioned paths are mistakes, not webhooks to capture
+	mux.HandleFunc(apiPrefix+"/", http.NotFound)
+}
+
+// routePatterns returns the mux patterns rt is served on, under the
+// versioned prefix and the legacy one
+func routePatterns(rt apiRoute) (current, legacy string) {
+	method := rt.Method + " "
+	if rt.AnyMethod {
+		method = ""
+	}
+	return method + apiPrefix + rt.Path, method + legacyAPIPrefix + rt.Path
+}
+
+// apiPaths matches exactly the calls registerAPI serves. Anything else
+// under /api, such as a POST to /api/orders, is a webhook to capture.
+var apiPaths = func() *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, rt := range apiRoutes() {
+		current, legacy := routePatterns(rt)
+		mux.HandleFunc(current, http.NotFound)
+		mux.HandleFunc(legacy, http.NotFound)
+	}
+	return mux
+}()
+
+// isAPICall reports whether r is for a route in the API table
+func isAPICall(r *http.Request) bool {
+	_, pattern := apiPaths.Handler(r)
+	return pattern != ""
+}
+
+// deprecatedAPI marks responses from a legacy path and points at the
+// versioned equivalent
+func deprecatedAPI(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		successor := apiPrefix + strings.TrimPrefix(r.URL.Path, legacyAPIPrefix)
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+		h(w, r)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// archiveTimeout bounds each upload, so a hung bucket fails a prune rather
+// than stalling it
+const archiveTimeout = 30 * time.Second
+
+// Archiver receives requests evicted by retention before they are deleted
+type Archiver interface {
+	Archive(info RequestInfo) error
+}
+
+// bucketArchiver writes each evicted request as a JSON object under a daily
+// prefix, e.g. prefix/2024/05/17/42.json. It speaks the S3 API, which GCS
+// also serves on storage.googleapis.com when given HMAC keys.
+type bucketArchiver struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// newBucketArchiver parses an archive URL such as s3://bucket/prefix or
+// gs://bucket/prefix. Credentials come from the standard AWS environment
+// variables (use HMAC keys for GCS) or the instance role. endpoint overrides
+// the default host, for S3-compatible services such as MinIO.
+func newBucketArchiver(rawURL, endpoint string) (*bucketArchiver, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint == "" {
+		switch u.Scheme {
+		case "s3":
+			endpoint = "s3.amazonaws.com"
+		case "gs":
+			endpoint = "storage.googleapis.com"
+		default:
+			return nil, fmt.Errorf("unsupported archive scheme %q", u.Scheme)
+		}
+	}
+	secure := true
+	if strings.HasPrefix(endpoint, "http://") {
+		secure = false
+	}
+	endpoint = strings.TrimPrefix(strings.TrimPrefix(endpoint, "http://"), "https://")
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.IAM{},
+		}),
+		Secure: secure,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &bucketArchiver{client: client, bucket: u.Host, prefix: strings.Trim(u.Path, "/")}, nil
+}
+
+func (a *bucketArchiver) Archive(info RequestInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	key := path.Join(a.prefix, info.Timestamp.UTC().Format("2006/01/02"), fmt.Sprintf("%d.json", info.ID))
+	ctx, cancel := context.WithTimeout(context.Background(), archiveTimeout)
+	defer cancel()
+	_, err = a.client.PutObject(ctx, a.bucket, key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/json"})
+	return err
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditKeep is how many audit entries are kept in memory for /api/v1/audit;
+// the file given to --audit-log keeps them all
+const auditKeep = 10000
+
+// AuditEntry records one change made through the management API, or one
+// export, and who made it
+type AuditEntry struct {
+	ID         int       `json:"id"`
+	Time       time.Time `json:"time"`
+	Actor      string    `json:"actor"`  // a user name, "admin token", "bin <token>" or "anonymous"
+	Action     string    `json:"action"` // the API operation, such as clearRequests
+	Method     string    `json:"method"`
+	Path       string    `json:"path"` // with credentials left out of the query
+	Bin        string    `json:"bin,omitempty"`
+	Status     int       `json:"status"`
+	RemoteAddr string    `json:"remote_addr"`
+	ClientIP   string    `json:"client_ip,omitempty"` // behind a trusted proxy
+}
+
+// auditLog holds the newest audit entries, appending every entry to a JSON
+// lines file when one is set
+type auditLog struct {
+	mu      sync.Mutex
+	f       *os.File
+	nextID  int
+	entries []AuditEntry
+}
+
+var audit = &auditLog{nextID: 1}
+
+// loadAudit reads the entries already in the file at path, if any, and
+// opens it to append new ones. An empty path keeps entries in memory only.
+func loadAudit(path string) error {
+	a := audit
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var e AuditEntry
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			continue
+		}
+		a.entries = append(a.entries, e)
+		a.nextID = max(a.nextID, e.ID+1)
+		if len(a.entries) > 2*auditKeep {
+			a.entries = append(a.entries[:0], a.entries[len(a.entries)-auditKeep:]...)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return err
+	}
+	if len(a.entries) > auditKeep {
+		a.entries = a.entries[len(a.entries)-auditKeep:]
+	}
+	a.f = f
+	return nil
+}
+
+func (a *auditLog) record(e AuditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e.ID = a.nextID
+	a.nextID++
+	a.entries = append(a.entries, e)
+	if len(a.entries) > 2*auditKeep {
+		a.entries = append(a.entries[:0], a.entries[len(a.entries)-auditKeep:]...)
+	}
+	if a.f == nil {
+		return
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if _, err := a.f.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+// auditSecretParams are query parameters carrying credentials, left out of
+// audited paths
+var auditSecretParams = []string{"read_token", "share"}
+
+// auditActor names who r acts as, the same way callerRole and binRole find
+// out what r may do
+func auditActor(r *http.Request) string {
+	if isAdminToken(bearerToken(r)) {
+		return "admin token"
+	}
+	if u, ok := sessionUser(r); ok {
+		return u.Username
+	}
+	if bin := r.URL.Query().Get("bin"); bins.protected(bin) && hasBinCredentials(r, bins.get(bin)) {
+		return "bin " + bin
+	}
+	return "anonymous"
+}
+
+// audited reports whether calls to rt go in the audit log: every change, and
+// reads marked Audit such as exports
+func audited(rt apiRoute) bool {
+	return !rt.Public && (rt.Audit || routeRole(rt) != roleViewer)
+}
+
+// statusWriter remembers the status a handler answered with
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(p)
+}
+
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// auditCalls records every call to h, including refused ones, as action
+func auditCalls(action string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		actor := auditActor(r)
+		h(sw, r)
+		q := r.URL.Query()
+		for _, name := range auditSecretParams {
+			q.Del(name)
+		}
+		path := r.URL.Path
+		if len(q) > 0 {
+			path += "?" + q.Encode()
+		}
+		audit.record(AuditEntry{
+			Time:       time.Now(),
+			Actor:      actor,
+			Action:     action,
+			Method:     r.Method,
+			Path:       path,
+			Bin:        q.Get("bin"),
+			Status:     sw.status,
+			RemoteAddr: r.RemoteAddr,
+			ClientIP:   clientIP(r),
+		})
+	}
+}
+
+// auditHandler lists audit entries newest first, optionally only those of
+// one actor, action or bin
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pg, err := parsePage(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if pg.limit == 0 {
+		pg.limit = 100
+	}
+	audit.mu.Lock()
+	list := []AuditEntry{}
+	for i := len(audit.entries) - 1; i >= 0; i-- {
+		e := audit.entries[i]
+		if actor := q.Get("actor"); actor != "" && !strings.EqualFold(e.Actor, actor) ||
+			q.Get("action") != "" && e.Action != q.Get("action") ||
+			q.Get("bin") != "" && e.Bin != q.Get("bin") {
+			continue
+		}
+		list = append(list, e)
+	}
+	audit.mu.Unlock()
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(list)))
+	list = list[min(pg.offset, len(list)):]
+	list = list[:min(pg.limit, len(list))]
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// adminToken guards the /api/v1/admin endpoints; they are disabled when empty
+var adminToken string
+
+// bearerToken returns the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// isAdminToken reports whether token is the admin token
+func isAdminToken(token string) bool {
+	return adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// requireRole only lets requests whose caller has at least need through to
+// h. Strangers are asked to log in; users short of the role are refused.
+// When binScoped, h acts on no more than the bin in ?bin= or {token}, so
+// that bin's credentials will do, confined to it by withBinScope.
+func requireRole(need role, binScoped bool, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		got := callerRole(r)
+		if !got.allows(need) && need != roleAdmin && binScoped {
+			if ro, scope := binRole(r); ro.allows(need) {
+				if scoped, ok := withBinScope(r, scope); ok {
+					h(w, scoped)
+					return
+				}
+			}
+		}
+		if got.allows(need) {
+			h(w, r)
+			return
+		}
+		if _, ok := sessionUser(r); ok {
+			http.Error(w, fmt.Sprintf("Forbidden; this needs the %s role", need), http.StatusForbidden)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="webhook-host"`)
+		http.Error(w, fmt.Sprintf("Unauthorized; log in as a user with the %s role", need), http.StatusUnauthorized)
+	}
+}
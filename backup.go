@@ -0,0 +1,131 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// backupManifest is written first in every backup tarball
+type backupManifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Count     int       `json:"count"`
+}
+
+// backupHandler streams a gzipped tarball holding a manifest and one
+// requests/<id>.json entry per request, oldest first, so large histories are
+// never assembled in memory as a single document
+func backupHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := store.List()
+	if err != nil {
+		http.Error(w, "Failed to list requests", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="webhook-host-backup-%s.tar.gz"`, now.Format("20060102-150405")))
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	writeEntry := func(name string, v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	}
+
+	err = writeEntry("manifest.json", backupManifest{Version: exportVersion, CreatedAt: now, Count: len(list)})
+	for i := len(list) - 1; i >= 0 && err == nil; i-- {
+		info := list[i]
+		if info.BodyRef != "" {
+			if info, err = store.Get(info.ID); err != nil {
+				break
+			}
+		}
+		err = writeEntry(fmt.Sprintf("requests/%08d.json", info.ID), info)
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		// Headers are already sent; abort so the client sees a broken archive
+		panic(http.ErrAbortHandler)
+	}
+}
+
+type restoreResponse struct {
+	Restored int `json:"restored"`
+}
+
+// restoreHandler replaces the current history with the contents of a backup
+// tarball produced by backupHandler
+func restoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		http.Error(w, "Backup is not gzip compressed", http.StatusBadRequest)
+		return
+	}
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != "manifest.json" {
+		http.Error(w, "Backup is missing its manifest", http.StatusBadRequest)
+		return
+	}
+	var manifest backupManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil || manifest.Version != exportVersion {
+		http.Error(w, "Unsupported backup manifest", http.StatusBadRequest)
+		return
+	}
+
+	if err := store.Clear(); err != nil {
+		http.Error(w, "Failed to clear requests", http.StatusInternalServerError)
+		return
+	}
+	restored := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Corrupt backup after %d requests", restored), http.StatusBadRequest)
+			return
+		}
+		if !strings.HasPrefix(hdr.Name, "requests/") || path.Ext(hdr.Name) != ".json" {
+			continue
+		}
+		var info RequestInfo
+		if err := json.NewDecoder(tr).Decode(&info); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid entry %s", hdr.Name), http.StatusBadRequest)
+			return
+		}
+		if err := addImported(info); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to restore %s", hdr.Name), http.StatusInternalServerError)
+			return
+		}
+		restored++
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(restoreResponse{Restored: restored})
+}
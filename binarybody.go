@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// decodeBinaryBody renders compact binary bodies as JSON for display,
+// returning the JSON and the format it came from, or nil when the body
+// isn't in a format it knows or doesn't parse
+func decodeBinaryBody(r *http.Request, body []byte) (json.RawMessage, string) {
+	if len(body) == 0 {
+		return nil, ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/msgpack" || mediaType == "application/x-msgpack" || mediaType == "application/vnd.msgpack":
+		return decodeMsgpack(body)
+	case mediaType == "application/cbor" || strings.HasSuffix(mediaType, "+cbor"):
+		return decodeCBOR(body)
+	}
+	return decodeProtobuf(r, body)
+}
+
+// decodeMsgpack converts a single MessagePack value to JSON. Binary values
+// become base64 strings.
+func decodeMsgpack(body []byte) (json.RawMessage, string) {
+	var out bytes.Buffer
+	if rest, err := msgp.UnmarshalAsJSON(&out, body); err != nil || len(rest) > 0 {
+		return nil, ""
+	}
+	// Several values back to back convert to something that isn't JSON
+	if !json.Valid(out.Bytes()) {
+		return nil, ""
+	}
+	return out.Bytes(), "msgpack"
+}
+
+// decodeCBOR converts a single CBOR data item to JSON
+func decodeCBOR(body []byte) (json.RawMessage, string) {
+	var v any
+	if err := cbor.Unmarshal(body, &v); err != nil {
+		return nil, ""
+	}
+	out, err := json.Marshal(jsonValue(v))
+	if err != nil {
+		return nil, ""
+	}
+	return out, "cbor"
+}
+
+// jsonValue makes a decoded CBOR value encodable as JSON: map keys, which
+// CBOR lets be any type, become strings, big integers become numbers and
+// tags are reduced to their content. Byte strings become base64 as usual.
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, val := range v {
+			key, ok := k.(string)
+			if !ok {
+				key = fmt.Sprint(jsonValue(k))
+			}
+			m[key] = jsonValue(val)
+		}
+		return m
+	case []any:
+		for i := range v {
+			v[i] = jsonValue(v[i])
+		}
+		return v
+	case cbor.Tag:
+		return jsonValue(v.Content)
+	case big.Int:
+		return json.Number(v.String())
+	case *big.Int:
+		return json.Number(v.String())
+	case cbor.SimpleValue:
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bin is a bin created through the API. Bins that are just used, by sending
+// to a token of one's choosing, have no record and never expire.
+type Bin struct {
+	Token     string     `json:"token"`
+	CreatedAt time.Time  `json:"created_at,omitzero"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Owner     int        `json:"owner,omitempty"` // ID of the user who created it, if logged in
+	// ReadToken must accompany API requests for the bin's captures, which
+	// are hidden from every other listing
+	ReadToken string `json:"read_token,omitempty"`
+	// Shares are the unexpired read-only links to the bin or its captures
+	Shares []Share `json:"shares,omitempty"`
+	// PasswordHash is the bcrypt hash of an optional password, accepted
+	// over HTTP basic auth in place of the read token
+	PasswordHash string `json:"password_hash,omitempty"`
+	// Limits replacing --bin-max-requests, --max-body-size and --max-age for
+	// this bin; zero keeps the global setting
+	MaxRequests int      `json:"max_requests,omitempty"`
+	MaxBodySize int64    `json:"max_body_size,omitempty"`
+	MaxAge      duration `json:"max_age,omitempty"`
+	// Quotas replacing --bin-rate-limit and --bin-max-storage
+	RateLimit  int   `json:"rate_limit,omitempty"` // webhooks a minute
+	MaxStorage int64 `json:"max_storage,omitempty"`
+	// Response is how the bin's webhooks are answered, if not the default
+	Response *Reply `json:"response,omitempty"`
+}
+
+func (b Bin) expired(now time.Time) bool {
+	return b.ExpiresAt != nil && !b.ExpiresAt.After(now)
+}
+
+// duration is a time.Duration written in JSON as a Go duration string
+type duration time.Duration
+
+func (d duration) MarshalText() ([]byte, error) { return []byte(time.Duration(d).String()), nil }
+
+func (d *duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	*d = duration(v)
+	return err
+}
+
+// binRegistry holds the created bins, and keeps them in a JSON file when a
+// path is set. Expired bins stay registered so their tokens keep answering
+// 404 rather than quietly starting a new history.
+type binRegistry struct {
+	mu   sync.Mutex
+	path string
+	bins map[string]Bin
+	ttl  time.Duration // expiry for bins created without their own
+}
+
+var bins = &binRegistry{bins: map[string]Bin{}}
+
+// loadBins reads the bins saved at path, if any. An empty path keeps bins in
+// memory only.
+func loadBins(path string, ttl time.Duration) error {
+	r := bins
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.path, r.ttl = path, ttl
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var list []Bin
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, b := range list {
+		r.bins[b.Token] = b
+	}
+	return nil
+}
+
+// save writes the bins to r.path, oldest first; callers hold r.mu
+func (r *binRegistry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	list := make([]Bin, 0, len(r.bins))
+	for _, b := range r.bins {
+		list = append(list, b)
+	}
+	slices.SortFunc(list, func(a, b Bin) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// create registers b under a new random token, expiring after ttl, or after
+// the default when ttl is 0
+func (r *binRegistry) create(b Bin, ttl time.Duration) (Bin, error) {
+	token, err := newBinToken()
+	if err != nil {
+		return Bin{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b.ReadToken, err = newBinToken(); err != nil {
+		return Bin{}, err
+	}
+	b.Token, b.CreatedAt = token, time.Now()
+	if ttl == 0 {
+		ttl = r.ttl
+	}
+	if ttl > 0 {
+		t := b.CreatedAt.Add(ttl)
+		b.ExpiresAt = &t
+	}
+	r.bins[token] = b
+	return b, r.save()
+}
+
+// get returns the created bin token names; unknown tokens give a zero Bin,
+// which never expires and has no limits of its own
+func (r *binRegistry) get(token string) Bin {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.bins[token]
+}
+
+// protected reports whether token names a bin with a read token
+func (r *binRegistry) protected(token string) bool {
+	return token != "" && r.get(token).ReadToken != ""
+}
+
+// anyProtected reports whether any created bin has a read token
+func (r *binRegistry) anyProtected() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, b := range r.bins {
+		if b.ReadToken != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// canReadBin reports whether r may see bin's captures: it must present the
+// bin's read token, or the admin token, as a bearer token or ?read_token=
+// for clients such as EventSource that can't set headers, or the bin's
+// password over basic auth, with any user name. Its owner's login works
+// too, as does an admin's, and a share link for the bin
+// will do for GETs. Bins without a read token are open to everyone.
+func canReadBin(r *http.Request, bin string) bool {
+	b := bins.get(bin)
+	if b.ReadToken == "" {
+		return true
+	}
+	if share, ok := presentedShare(r, b); ok && share.RequestID == 0 {
+		return true
+	}
+	return hasBinCredentials(r, b)
+}
+
+// hasBinCredentials reports whether r carries a credential with full rights
+// over b
+func hasBinCredentials(r *http.Request, b Bin) bool {
+	if u, ok := sessionUser(r); ok && (b.Owner != 0 && u.ID == b.Owner || u.role() == roleAdmin) {
+		return true
+	}
+	want := b.ReadToken
+	if _, password, ok := r.BasicAuth(); ok && b.PasswordHash != "" {
+		return bcrypt.CompareHashAndPassword([]byte(b.PasswordHash), []byte(password)) == nil
+	}
+	got := bearerToken(r)
+	if got == "" {
+		got = r.URL.Query().Get("read_token")
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1 ||
+		adminToken != "" && subtle.ConstantTimeCompare([]byte(got), []byte(adminToken)) == 1
+}
+
+// requireBinToken refuses API requests scoped by ?bin= to a protected bin
+// unless they may read it. Handlers taking a bin from their body check it
+// themselves.
+func requireBinToken(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if bin := r.URL.Query().Get("bin"); !canReadBin(r, bin) {
+			binUnauthorized(w, bin)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// binUnauthorized answers a request that may not read bin, inviting a
+// browser to ask for the password when the bin has one
+func binUnauthorized(w http.ResponseWriter, bin string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="webhook-host"`)
+	if bins.get(bin).PasswordHash != "" {
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm="bin %s"`, bin))
+		http.Error(w, "Unauthorized; send the bin's password or read token", http.StatusUnauthorized)
+		return
+	}
+	http.Error(w, "Unauthorized; send the bin's read token as a bearer token or ?read_token=", http.StatusUnauthorized)
+}
+
+// all returns the created bins by token
+func (r *binRegistry) all() map[string]Bin {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return maps.Clone(r.bins)
+}
+
+// binDomain, set by --bin-domain, turns the first label of hosts below it
+// into a bin token, so abc123.hooks.example.com captures into bin abc123
+var binDomain string
+
+// hostBin returns the bin a request for host is addressed to, or "" when
+// host isn't a single label below binDomain
+func hostBin(host string) string {
+	if binDomain == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	label, ok := strings.CutSuffix(strings.ToLower(host), "."+binDomain)
+	if !ok || label == "" || strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
+
+// routeBinHosts captures every request addressed to a bin host, whatever its
+// path, so the API and UI are only reachable on the main domain
+func routeBinHosts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if bin := hostBin(r.Host); bin != "" {
+			r.SetPathValue("token", bin)
+			webhookHandler(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newBinToken returns an unguessable bin token of 128 random bits
+func newBinToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// binInput is the optional body accepted when creating a bin
+type binInput struct {
+	// ExpiresIn and MaxAge are Go durations such as 24h; without an
+	// ExpiresIn bins get the --bin-ttl default
+	ExpiresIn   string `json:"expires_in"`
+	MaxRequests int    `json:"max_requests"`
+	MaxBodySize string `json:"max_body_size"` // such as 64KB or 10MB
+	MaxAge      string `json:"max_age"`
+	RateLimit   int    `json:"rate_limit"`
+	MaxStorage  string `json:"max_storage"` // such as 50MB
+	Response    *Reply `json:"response"`
+	// Password lets people into the bin's captures with basic auth, for
+	// browsers without the read token
+	Password string `json:"password"`
+}
+
+// binResponse describes a freshly created bin
+type binResponse struct {
+	Bin
+	URL        string `json:"url"`                // where to send webhooks
+	HostURL    string `json:"host_url,omitempty"` // the same bin by hostname, with --bin-domain
+	InspectURL string `json:"inspect_url"`        // the UI showing just this bin
+}
+
+// createBinHandler creates a bin with a random token, optionally from a body
+// such as {"expires_in": "24h", "max_requests": 500}, and answers with the
+// URLs for sending to and watching it, ready to hand to a provider
+func createBinHandler(w http.ResponseWriter, r *http.Request) {
+	var in binInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	ttl, ok := positiveDuration(w, "expires_in", in.ExpiresIn)
+	if !ok {
+		return
+	}
+	maxAge, ok := positiveDuration(w, "max_age", in.MaxAge)
+	if !ok {
+		return
+	}
+	if in.MaxRequests < 0 {
+		http.Error(w, "Invalid max_requests; use a positive count", http.StatusBadRequest)
+		return
+	}
+	if in.RateLimit < 0 {
+		http.Error(w, "Invalid rate_limit; use a positive count", http.StatusBadRequest)
+		return
+	}
+	if in.Response != nil {
+		if err := in.Response.validate(); err != nil {
+			http.Error(w, "Invalid response: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	b := Bin{MaxRequests: in.MaxRequests, MaxAge: duration(maxAge), RateLimit: in.RateLimit, Response: in.Response}
+	if u, ok := sessionUser(r); ok {
+		b.Owner = u.ID
+	}
+	if in.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
+		if err != nil {
+			// Only passwords over 72 bytes fail
+			http.Error(w, "Invalid password; use at most 72 bytes", http.StatusBadRequest)
+			return
+		}
+		b.PasswordHash = string(hash)
+	}
+	if in.MaxBodySize != "" {
+		size, err := parseSize(in.MaxBodySize)
+		if err != nil {
+			http.Error(w, "Invalid max_body_size; use a size such as 64KB or 10MB", http.StatusBadRequest)
+			return
+		}
+		b.MaxBodySize = int64(size)
+	}
+	if in.MaxStorage != "" {
+		size, err := parseSize(in.MaxStorage)
+		if err != nil {
+			http.Error(w, "Invalid max_storage; use a size such as 50MB", http.StatusBadRequest)
+			return
+		}
+		b.MaxStorage = int64(size)
+	}
+	b, err := bins.create(b, ttl)
+	if err != nil {
+		http.Error(w, "Failed to create bin", http.StatusInternalServerError)
+		return
+	}
+	base := requestBase(r)
+	b.PasswordHash = ""
+	resp := binResponse{
+		Bin:        b,
+		URL:        base + "/b/" + b.Token,
+		InspectURL: base + "/ui/?" + url.Values{"bin": {b.Token}, "read_token": {b.ReadToken}}.Encode(),
+	}
+	if binDomain != "" {
+		scheme, _, _ := strings.Cut(base, "://")
+		host := b.Token + "." + binDomain
+		if _, port, err := net.SplitHostPort(r.Host); err == nil {
+			host = net.JoinHostPort(host, port)
+		}
+		resp.HostURL = scheme + "://" + host + "/"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/b/"+b.Token)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// positiveDuration parses the optional duration field name, writing an error
+// response and returning false when it isn't a positive duration
+func positiveDuration(w http.ResponseWriter, name, v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, true
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(v))
+	if err != nil || d <= 0 {
+		http.Error(w, fmt.Sprintf("Invalid %s; use a positive duration such as 24h", name), http.StatusBadRequest)
+		return 0, false
+	}
+	return d, true
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// binNamePattern is what a bin may be renamed to: a DNS label, so the bin
+// stays reachable under --bin-domain
+var binNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// errBinExists is returned by rename when the new name is in use
+var errBinExists = errors.New("bin name taken")
+
+// binUsage is a bin, created or just used, with what its captures take up
+type binUsage struct {
+	Bin
+	Created       bool       `json:"created"` // registered through POST /bins rather than just sent to
+	Expired       bool       `json:"expired,omitempty"`
+	Requests      int        `json:"requests"`
+	Pinned        int        `json:"pinned"`
+	Bytes         int64      `json:"bytes"` // approximate, as counted for --bin-max-storage
+	LastRequestAt *time.Time `json:"last_request_at,omitempty"`
+}
+
+// binUsages returns every created bin and every bin s holds captures for,
+// the unscoped history under "", by token
+func binUsages(s Store, now time.Time) ([]binUsage, error) {
+	usage := map[string]*binUsage{}
+	for token, b := range bins.all() {
+		b.PasswordHash = ""
+		usage[token] = &binUsage{Bin: b, Created: true, Expired: b.expired(now)}
+	}
+	err := s.Each(func(info RequestInfo) error {
+		u, ok := usage[info.Bin]
+		if !ok {
+			u = &binUsage{Bin: Bin{Token: info.Bin}}
+			usage[info.Bin] = u
+		}
+		u.Requests++
+		if info.Pinned {
+			u.Pinned++
+		}
+		u.Bytes += approxSize(info)
+		if u.LastRequestAt == nil || info.Timestamp.After(*u.LastRequestAt) {
+			t := info.Timestamp
+			u.LastRequestAt = &t
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	list := make([]binUsage, 0, len(usage))
+	for _, u := range usage {
+		list = append(list, *u)
+	}
+	slices.SortFunc(list, func(a, b binUsage) int { return strings.Compare(a.Token, b.Token) })
+	return list, nil
+}
+
+// rename moves the created bin from to the name to, if it was created
+func (r *binRegistry) rename(from, to string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.bins[to]; ok {
+		return errBinExists
+	}
+	b, ok := r.bins[from]
+	if !ok {
+		return nil
+	}
+	delete(r.bins, from)
+	b.Token = to
+	r.bins[to] = b
+	return r.save()
+}
+
+// setExpiry makes the created bin token expire at t, or never when nil
+func (r *binRegistry) setExpiry(token string, t *time.Time) (Bin, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.bins[token]
+	if !ok {
+		return Bin{}, ErrNotFound
+	}
+	b.ExpiresAt = t
+	r.bins[token] = b
+	return b, r.save()
+}
+
+func (r *binRegistry) remove(token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.bins[token]; !ok {
+		return nil
+	}
+	delete(r.bins, token)
+	return r.save()
+}
+
+// adminListBinsHandler lists every bin with its usage
+func adminListBinsHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := binUsages(store, time.Now())
+	if err != nil {
+		http.Error(w, "Failed to list bins", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// binAdminPatch is the body accepted when changing a bin
+type binAdminPatch struct {
+	Token string `json:"token"` // a new name, moving the bin's captures with it
+	// ExpiresIn is a Go duration from now, or "never"; only created bins
+	// can expire
+	ExpiresIn string `json:"expires_in"`
+}
+
+// adminPatchBinHandler renames a bin or changes when it expires, from a body
+// such as {"token": "stripe-prod", "expires_in": "720h"}
+func adminPatchBinHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.PathValue("token")
+	var patch binAdminPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	var expires *time.Time
+	if patch.ExpiresIn != "" && patch.ExpiresIn != "never" {
+		ttl, ok := positiveDuration(w, "expires_in", patch.ExpiresIn)
+		if !ok {
+			return
+		}
+		t := time.Now().Add(ttl)
+		expires = &t
+	}
+	if patch.Token != "" && patch.Token != token {
+		if !binNamePattern.MatchString(patch.Token) {
+			http.Error(w, "Invalid token; use up to 63 lowercase letters, digits and dashes", http.StatusBadRequest)
+			return
+		}
+		if err := renameBin(token, patch.Token); errors.Is(err, errBinExists) {
+			http.Error(w, "Bin name taken", http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to rename bin", http.StatusInternalServerError)
+			return
+		}
+		token = patch.Token
+	}
+	if patch.ExpiresIn != "" {
+		if _, err := bins.setExpiry(token, expires); errors.Is(err, ErrNotFound) {
+			http.Error(w, "Only created bins expire", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to save bin", http.StatusInternalServerError)
+			return
+		}
+	}
+	b := bins.get(token)
+	b.Token, b.PasswordHash = token, ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b)
+}
+
+// renameBin moves bin from, and every capture in it, to the name to, which
+// must neither be created nor hold captures
+func renameBin(from, to string) error {
+	list, err := store.List()
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(list, func(info RequestInfo) bool { return info.Bin == to }) {
+		return errBinExists
+	}
+	if err := bins.rename(from, to); err != nil {
+		return err
+	}
+	for _, info := range list {
+		if info.Bin != from {
+			continue
+		}
+		if err := store.Update(info.ID, func(i *RequestInfo) { i.Bin = to }); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	quotas.mu.Lock()
+	delete(quotas.bins, from)
+	quotas.mu.Unlock()
+	return nil
+}
+
+// adminDeleteBinHandler deletes a bin and all its captures, pinned ones too
+func adminDeleteBinHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.PathValue("token")
+	list, err := store.List()
+	if err != nil {
+		http.Error(w, "Failed to delete bin", http.StatusInternalServerError)
+		return
+	}
+	deleted := 0
+	for _, info := range list {
+		if info.Bin != token {
+			continue
+		}
+		if err := store.Delete(info.ID); err != nil && !errors.Is(err, ErrNotFound) {
+			http.Error(w, "Failed to delete bin", http.StatusInternalServerError)
+			return
+		}
+		deleted++
+	}
+	if err := bins.remove(token); err != nil {
+		http.Error(w, "Failed to delete bin", http.StatusInternalServerError)
+		return
+	}
+	quotas.mu.Lock()
+	delete(quotas.bins, token)
+	quotas.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deleteResponse{Deleted: deleted})
+}
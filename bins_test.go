@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestServer resets the state handlers share and serves the API and
+// webhooks on a memory store, as main sets them up
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	store, retention = newTallyStore(&eventStore{Store: newMemoryStore()}), Retention{}
+	bins = &binRegistry{bins: map[string]Bin{}}
+	anonymousRole, adminToken = roleEditor, ""
+	mux := http.NewServeMux()
+	registerAPI(mux)
+	mux.HandleFunc("/", webhookHandler)
+	mux.HandleFunc("/b/{token}", webhookHandler)
+	mux.HandleFunc("/b/{token}/", webhookHandler)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// send makes a request to srv, returning its status and body; header holds
+// name, value pairs
+func send(t *testing.T, srv *httptest.Server, method, path, body string, header ...string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+// createProtectedBin creates a bin through the API, returning its token and
+// read token
+func createProtectedBin(t *testing.T, srv *httptest.Server) (token, readToken string) {
+	t.Helper()
+	status, body := send(t, srv, "POST", "/api/v1/bins", `{"protected": true}`)
+	var b binResponse
+	if err := json.Unmarshal([]byte(body), &b); status != http.StatusCreated || err != nil || b.ReadToken == "" {
+		t.Fatalf("creating a bin = %d %s", status, body)
+	}
+	return b.Token, b.ReadToken
+}
+
+// countCaptures returns how many captures a listing body holds
+func countCaptures(t *testing.T, body string) int {
+	t.Helper()
+	var list []RequestInfo
+	if err := json.Unmarshal([]byte(body), &list); err != nil {
+		t.Fatalf("listing %q: %v", body, err)
+	}
+	return len(list)
+}
+
+func TestBinReadToken(t *testing.T) {
+	srv := newTestServer(t)
+	bin, readToken := createProtectedBin(t, srv)
+	send(t, srv, "POST", "/b/"+bin+"/hook", "secret")
+	send(t, srv, "POST", "/open", "public")
+
+	tests := []struct {
+		name   string
+		path   string
+		header []string
+		status int
+		count  int
+	}{
+		{"without the token", "/api/v1/requests?bin=" + bin, nil, http.StatusUnauthorized, -1},
+		{"wrong token", "/api/v1/requests?bin=" + bin + "&read_token=nope", nil, http.StatusUnauthorized, -1},
+		{"query token", "/api/v1/requests?bin=" + bin + "&read_token=" + readToken, nil, http.StatusOK, 1},
+		{"bearer token", "/api/v1/requests?bin=" + bin, []string{"Authorization", "Bearer " + readToken}, http.StatusOK, 1},
+		{"unfiltered listing", "/api/v1/requests", nil, http.StatusOK, 1},
+		{"export", "/api/v1/export?bin=" + bin, nil, http.StatusUnauthorized, -1},
+	}
+	for _, tt := range tests {
+		status, body := send(t, srv, "GET", tt.path, "", tt.header...)
+		if status != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, status, tt.status, body)
+			continue
+		}
+		if tt.count >= 0 {
+			if n := countCaptures(t, body); n != tt.count {
+				t.Errorf("%s: %d captures, want %d", tt.name, n, tt.count)
+			}
+		}
+	}
+}
+
+func TestImportRespectsProtectedBins(t *testing.T) {
+	srv := newTestServer(t)
+	bin, readToken := createProtectedBin(t, srv)
+	send(t, srv, "POST", "/b/"+bin+"/hook", "secret")
+	forged := `{"version": 1, "requests": [{"method": "POST", "url": "/forged", "bin": "` + bin + `", "body": "x"}]}`
+
+	if status, body := send(t, srv, "POST", "/api/v1/import", forged); status != http.StatusUnauthorized {
+		t.Errorf("importing into a protected bin without its token = %d %s", status, body)
+	}
+	if status, body := send(t, srv, "POST", "/api/v1/import?replace=true", `{"version": 1, "requests": []}`); status != http.StatusOK {
+		t.Errorf("replacing = %d %s", status, body)
+	}
+	list := "/api/v1/requests?bin=" + bin + "&read_token=" + readToken
+	if _, body := send(t, srv, "GET", list, ""); countCaptures(t, body) != 1 {
+		t.Errorf("replace or a refused import changed the protected bin: %s", body)
+	}
+	if status, body := send(t, srv, "POST", "/api/v1/import?read_token="+readToken, forged); status != http.StatusOK {
+		t.Errorf("importing with the bin's token = %d %s", status, body)
+	}
+	if _, body := send(t, srv, "GET", list, ""); countCaptures(t, body) != 2 {
+		t.Errorf("import with the bin's token didn't add to it: %s", body)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// RequestInfo holds details about a captured HTTP request
+type RequestInfo struct {
+	ID           int             `json:"id"`
+	Bin          string          `json:"bin,omitempty"` // token of the /b/{token} bin it was sent to
+	Method       string          `json:"method"`
+	URL          string          `json:"url"`
+	Proto        string          `json:"proto,omitempty"` // such as HTTP/1.1 or HTTP/2.0
+	TLS          *TLSInfo        `json:"tls,omitempty"`   // set for requests over HTTPS
+	Query        url.Values      `json:"query,omitempty"` // decoded from URL
+	Headers      Header          `json:"headers"`
+	Cookies      []Cookie        `json:"cookies,omitempty"`    // parsed from the Cookie header
+	UserAgent    *UserAgent      `json:"user_agent,omitempty"` // parsed from the User-Agent header
+	JWT          *JWT            `json:"jwt,omitempty"`        // decoded from an Authorization: Bearer header
+	Chunked      bool            `json:"chunked,omitempty"`    // sent with chunked transfer encoding
+	Trailers     Header          `json:"trailers,omitempty"`   // trailer fields sent after a chunked body
+	Body         string          `json:"body"`
+	BodyEncoding string          `json:"body_encoding,omitempty"` // "base64" when Body holds a binary body base64-encoded
+	DetectedType string          `json:"detected_type,omitempty"` // json, xml, form, binary or text, sniffed from the body whatever its Content-Type
+	BodySize     int             `json:"body_size"`               // bytes as received, after any decompression
+	Truncated    bool            `json:"truncated,omitempty"`     // the body passed --max-body-size and was cut off there
+	BodyHash     string          `json:"body_hash,omitempty"`     // hex SHA-256 of the body
+	DecodedFrom  string          `json:"decoded_from,omitempty"`  // Content-Encoding the body was decompressed from
+	EncodedSize  int             `json:"encoded_size,omitempty"`  // bytes before decompression
+	GraphQL      *GraphQL        `json:"graphql,omitempty"`       // the operation of a GraphQL request
+	XML          *XMLInfo        `json:"xml,omitempty"`           // root element, SOAP details and pretty form of an XML body
+	CloudEvent   *CloudEvent     `json:"cloudevent,omitempty"`    // context attributes of a CloudEvents request
+	DecodedBody  json.RawMessage `json:"decoded_body,omitempty"`  // a binary body rendered as JSON
+	DecodedAs    string          `json:"decoded_as,omitempty"`    // msgpack, cbor or "protobuf <message>"
+	Form         url.Values      `json:"form,omitempty"`          // fields of a urlencoded or multipart form body
+	Files        []FilePart      `json:"files,omitempty"`         // uploads in a multipart/form-data body
+	Raw          []byte          `json:"raw,omitempty"`           // the request in wire format, with --raw-dump
+	RawExact     bool            `json:"raw_exact,omitempty"`     // Raw was recorded byte for byte rather than rebuilt
+	Timing       *Timing         `json:"timing,omitempty"`
+	Timestamp    time.Time       `json:"timestamp"`
+	RemoteAddr   string          `json:"remote_addr"`            // the direct peer, which may be a proxy
+	ClientIP     string          `json:"client_ip,omitempty"`    // the client behind a trusted proxy
+	Geo          *Geo            `json:"geo,omitempty"`          // where the sender is, with --geoip-db
+	Hostname     string          `json:"hostname,omitempty"`     // reverse DNS name of the sender, with --reverse-dns
+	LocalAddr    string          `json:"local_addr,omitempty"`   // listener address the request arrived on
+	KeepAlive    bool            `json:"keep_alive,omitempty"`   // the client left the connection open for more requests
+	ConnRequest  int             `json:"conn_request,omitempty"` // place on its connection, 1 for a new connection
+	Status       int             `json:"status"`                 // status webhook-host answered with
+	Reply        *Reply          `json:"reply,omitempty"`        // the rest of the answer, unless the built-in one
+	Rule         int             `json:"rule,omitempty"`         // ID of the rule that chose the answer
+	RuleGroups   ruleGroups      `json:"rule_groups,omitempty"`  // what the rule's pattern groups caught
+	ExpiresAt    *time.Time      `json:"expires_at,omitempty"`
+	Notes        string          `json:"notes,omitempty"`
+	Tags         []string        `json:"tags,omitempty"`
+	Pinned       bool            `json:"pinned,omitempty"` // exempt from retention and clears
+
+	// Storage bookkeeping set by Store decorators. BodyRef names the spill
+	// file holding the full body when Body is only a preview;
+	// BodyCompression is set only on the stored form of a compressed body;
+	// Sealed carries the encrypted URL, headers, body and what's derived
+	// from them when encryption is on.
+	BodyRef         string `json:"body_ref,omitempty"`
+	BodyCompression string `json:"body_compression,omitempty"`
+	Sealed          string `json:"sealed,omitempty"`
+
+	// Seen is how many stored captures share this body, filled in by the API
+	Seen int `json:"seen,omitempty"`
+}
+
+// Timing records how long webhook-host spent on a capture, in milliseconds
+// from when its headers had been read. Slow ReadBody points at the sender,
+// slow Store at our own disk or database.
+type Timing struct {
+	ReadBody float64 `json:"read_body_ms"`
+	Store    float64 `json:"store_ms"`
+	Total    float64 `json:"total_ms"`
+}
+
+// millis converts d to fractional milliseconds
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Header holds every value of each request header under its canonical name,
+// values in the order they arrived. net/http doesn't keep the order of
+// different names, so that is lost.
+type Header map[string][]string
+
+// Get returns the first value of the header k, or ""
+func (h Header) Get(k string) string {
+	return http.Header(h).Get(k)
+}
+
+// UnmarshalJSON also accepts the single string values captures were stored
+// with before every value was kept
+func (h *Header) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		*h = nil
+		return nil
+	}
+	out := make(Header, len(raw))
+	for k, v := range raw {
+		var values []string
+		if err := json.Unmarshal(v, &values); err != nil {
+			var single string
+			if json.Unmarshal(v, &single) != nil {
+				return err
+			}
+			values = []string{single}
+		}
+		out[k] = values
+	}
+	*h = out
+	return nil
+}
+
+// Cookie is one name/value pair from a request's Cookie header
+type Cookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// requestCookies parses r's Cookie headers, in order, skipping malformed pairs
+func requestCookies(r *http.Request) []Cookie {
+	var out []Cookie
+	for _, c := range r.Cookies() {
+		out = append(out, Cookie{Name: c.Name, Value: c.Value})
+	}
+	return out
+}
+
+// requestTrailers returns the trailer fields that arrived after r's body,
+// which must have been read to the end. Fields announced in the Trailer
+// header but never sent are left out.
+func requestTrailers(r *http.Request) Header {
+	var out Header
+	for k, v := range r.Trailer {
+		if len(v) == 0 {
+			continue
+		}
+		if out == nil {
+			out = Header{}
+		}
+		out[k] = slices.Clone(v)
+	}
+	return out
+}
+
+// newRequestInfo builds the capture record for r from its already-read body.
+// It has no side effects, so capture behaviour can be exercised without a
+// server or store.
+func newRequestInfo(r *http.Request, body []byte) RequestInfo {
+	wire := body
+	var decodedFrom string
+	encodedSize := 0
+	if codings := contentEncodings(Header(r.Header)); len(codings) > 0 {
+		if decoded, ok := decodeBody(codings, body); ok {
+			decodedFrom, encodedSize = strings.Join(codings, ", "), len(body)
+			body = decoded
+		}
+	}
+	// Everything below sees only the masked copy
+	r, body, redacted := redactions.apply(r, body)
+	if masked, _, ok := ownCookies.apply(r, nil); ok {
+		r, redacted = masked, true
+	}
+	headers := Header(r.Header.Clone())
+	text, encoding := encodeBody(body)
+	form, files := parseForm(r.Header.Get("Content-Type"), body)
+	decoded, decodedAs := decodeBinaryBody(r, body)
+	now := time.Now()
+	info := RequestInfo{
+		Method:       r.Method,
+		URL:          r.URL.String(),
+		Proto:        r.Proto,
+		TLS:          newTLSInfo(r.TLS, connFingerprint(r)),
+		Query:        r.URL.Query(),
+		Headers:      headers,
+		Cookies:      requestCookies(r),
+		UserAgent:    parseUserAgent(r.UserAgent()),
+		JWT:          requestJWT(r.Header.Get("Authorization"), now),
+		Chunked:      slices.Contains(r.TransferEncoding, "chunked"),
+		Trailers:     requestTrailers(r),
+		Body:         text,
+		BodyEncoding: encoding,
+		DetectedType: detectType(body),
+		BodySize:     len(body),
+		BodyHash:     hashBody(body),
+		DecodedFrom:  decodedFrom,
+		EncodedSize:  encodedSize,
+		GraphQL:      parseGraphQL(r, body),
+		XML:          parseXML(r, body),
+		CloudEvent:   parseCloudEvent(r, body),
+		DecodedBody:  decoded,
+		DecodedAs:    decodedAs,
+		Form:         form,
+		Files:        files,
+		Timestamp:    now,
+		RemoteAddr:   r.RemoteAddr,
+		ClientIP:     clientIP(r),
+		LocalAddr:    localAddr(r),
+		KeepAlive:    !r.Close,
+		ConnRequest:  connRequestNumber(r),
+	}
+	info.Geo = lookupGeo(senderIP(info))
+	if rawDump {
+		if redacted {
+			// The wire recording holds what was masked, so the dump is
+			// rebuilt around the decoded, masked body
+			r.Header.Del("Content-Encoding")
+			if r.Header.Get("Content-Length") != "" {
+				r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+			}
+			r.ContentLength = int64(len(body))
+			info.Raw = dumpRequest(r, body)
+		} else {
+			info.Raw, info.RawExact = rawRequest(r, wire)
+		}
+	}
+	return info
+}
+
+// encodeBody returns body as text, base64-encoding it with encoding "base64"
+// when it isn't valid UTF-8 or holds NUL bytes, which text never does
+func encodeBody(body []byte) (text, encoding string) {
+	if utf8.Valid(body) && bytes.IndexByte(body, 0) < 0 {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// rawBody returns the body bytes as received
+func (info RequestInfo) rawBody() ([]byte, error) {
+	if info.BodyEncoding == "base64" {
+		return base64.StdEncoding.DecodeString(info.Body)
+	}
+	return []byte(info.Body), nil
+}
+
+// hashBody returns the hex SHA-256 of body, or "" for an empty body
+func hashBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// countSeen sets Seen on every request in list to the number of requests in
+// list carrying the same body
+func countSeen(list []RequestInfo) {
+	counts := make(map[string]int)
+	for _, info := range list {
+		if info.BodyHash != "" {
+			counts[info.BodyHash]++
+		}
+	}
+	for i := range list {
+		list[i].Seen = counts[list[i].BodyHash]
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+)
+
+// CloudEvent holds the context attributes of a CloudEvents request
+type CloudEvent struct {
+	Mode            string `json:"mode"` // binary, with ce- headers, or structured, in the body
+	SpecVersion     string `json:"specversion"`
+	ID              string `json:"id"`
+	Type            string `json:"type"`
+	Source          string `json:"source"`
+	Subject         string `json:"subject,omitempty"`
+	Time            string `json:"time,omitempty"`
+	DataContentType string `json:"datacontenttype,omitempty"`
+}
+
+// parseCloudEvent recognises a CloudEvent sent over HTTP in binary mode,
+// where the attributes are ce- headers and the body is the data, or in
+// structured mode, where the body is an application/cloudevents+json
+// envelope. It returns nil for anything else.
+func parseCloudEvent(r *http.Request, body []byte) *CloudEvent {
+	if v := r.Header.Get("Ce-Specversion"); v != "" {
+		return &CloudEvent{
+			Mode:            "binary",
+			SpecVersion:     v,
+			ID:              r.Header.Get("Ce-Id"),
+			Type:            r.Header.Get("Ce-Type"),
+			Source:          r.Header.Get("Ce-Source"),
+			Subject:         r.Header.Get("Ce-Subject"),
+			Time:            r.Header.Get("Ce-Time"),
+			DataContentType: r.Header.Get("Content-Type"),
+		}
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/cloudevents+json" {
+		return nil
+	}
+	var ev CloudEvent
+	if json.Unmarshal(body, &ev) != nil || ev.SpecVersion == "" {
+		return nil
+	}
+	ev.Mode = "structured"
+	return &ev
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCompressOnlyAPIRoutes(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Config.Handler = compressResponses(srv.Config.Handler)
+	tests := []struct {
+		method, path string
+		compressed   bool
+	}{
+		{"GET", "/api/v1/requests", true},
+		{"GET", "/api/requests", true},
+		{"GET", "/api/v1/requests/1", true},
+		{"POST", "/api/orders", false},
+		{"POST", "/api/requests/1", false},
+		{"POST", "/hook", false},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(strings.Repeat("x", 100)))
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("Content-Encoding") == "gzip"; got != tt.compressed {
+			t.Errorf("%s %s: Content-Encoding %q, want compressed %t", tt.method, tt.path, resp.Header.Get("Content-Encoding"), tt.compressed)
+		}
+	}
+	if n, _ := store.Count(); n != 3 {
+		t.Errorf("captured %d requests, want the 3 webhooks", n)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the runtime settings, taken from flags with environment fallbacks
+type Config struct {
+	Port           string
+	TLSCert        string
+	TLSKey         string
+	ClientAuth     string
+	ClientCA       string
+	TrustedProxies string
+	GeoIPDB        string
+	ReverseDNS     time.Duration
+	ProtoDescs     string
+	ProtoMessages  string
+	Redact         string
+	AdminToken     string
+	Store          string
+	DBPath         string
+	DBURL          string
+	DBMaxConns     int
+	WALPath        string
+
+	RedisURL    string
+	RedisPrefix string
+	EventsRedis string
+
+	SpillThreshold byteSize
+	MaxBodySize    byteSize
+	SpillDir       string
+	Compress       string
+
+	EncryptionKeyFile string
+
+	Retention       Retention
+	PruneInterval   time.Duration
+	PurgeCron       string
+	PurgeWindow     time.Duration
+	ArchiveURL      string
+	ArchiveEndpoint string
+
+	ElasticURL    string
+	ElasticIndex  string
+	ElasticAPIKey string
+
+	ClickHouseURL   string
+	ClickHouseTable string
+
+	CaptureLog        string
+	CaptureLogMaxSize byteSize
+	CaptureLogDaily   bool
+	CaptureLogKeep    int
+
+	NotifyExec       string
+	NotifyExecFilter string
+
+	NotificationsFile string
+	BinsFile          string
+	UsersFile         string
+	Signup            bool
+	SessionKey        string
+	AnonymousRole     string
+	AuditLog          string
+	DefaultRole       string
+	AdminUser         string
+	AdminPassword     string
+	BinDomain         string
+	BinTTL            time.Duration
+	BinRateLimit      int
+	BinMaxStorage     byteSize
+
+	ResponseStatus      int
+	ResponseContentType string
+	ResponseHeaders     headerList
+	ResponseBody        string
+	ResponseTemplate    bool
+	Echo                bool
+	EchoHeaders         string
+	RulesFile           string
+
+	PublicURL           string
+	GitHubClientID      string
+	GitHubClientSecret  string
+	GoogleClientID      string
+	GoogleClientSecret  string
+	OIDCIssuer          string
+	OIDCClientID        string
+	OIDCClientSecret    string
+	OAuthAllowedDomains string
+
+	RawDump bool
+
+	TUI bool
+}
+
+func loadConfig() Config {
+	var c Config
+	flag.StringVar(&c.Port, "port", envOr("PORT", "8080"), "port to listen on")
+	flag.StringVar(&c.TLSCert, "tls-cert", envOr("TLS_CERT_FILE", ""), "PEM certificate file; serve HTTPS instead of HTTP when set together with --tls-key")
+	flag.StringVar(&c.TLSKey, "tls-key", envOr("TLS_KEY_FILE", ""), "PEM private key file for --tls-cert")
+	flag.StringVar(&c.ClientAuth, "tls-client-auth", envOr("TLS_CLIENT_AUTH", "none"), "ask HTTPS clients for a certificate: none, request or require")
+	flag.StringVar(&c.ClientCA, "tls-client-ca", envOr("TLS_CLIENT_CA", ""), "PEM CA bundle to verify client certificates against; without one they are recorded unverified")
+	flag.StringVar(&c.TrustedProxies, "trusted-proxies", envOr("TRUSTED_PROXIES", ""), "comma separated CIDRs of reverse proxies whose Forwarded, X-Forwarded-For and X-Real-IP headers name the real client")
+	flag.StringVar(&c.GeoIPDB, "geoip-db", envOr("GEOIP_DB", ""), "comma separated MaxMind .mmdb files, such as GeoLite2-City and GeoLite2-ASN, to locate senders with")
+	flag.DurationVar(&c.ReverseDNS, "reverse-dns", envDuration("REVERSE_DNS", 0), "look up sender hostnames in the background, giving up after this long, 0 to skip")
+	flag.StringVar(&c.ProtoDescs, "proto-descriptors", envOr("PROTO_DESCRIPTORS", ""), "comma separated descriptor sets from protoc --include_imports --descriptor_set_out, for decoding protobuf bodies")
+	flag.StringVar(&c.ProtoMessages, "proto-messages", envOr("PROTO_MESSAGES", ""), `comma separated "/path/prefix=package.Message" routes naming the message protobuf bodies hold, when the Content-Type doesn't`)
+	flag.StringVar(&c.Redact, "redact", envOr("REDACT", ""), `comma separated values to mask before storage: header names like Authorization or X-Api-*, JSON paths like $.card.number or $.items[*].token, and query:, form: or cookie: names`)
+	flag.StringVar(&c.AdminToken, "admin-token", envOr("ADMIN_TOKEN", ""), "bearer token with the admin role, for the /api/v1/admin endpoints and managing users")
+	flag.StringVar(&c.Store, "store", envOr("STORE", "memory"), "storage backend: memory, sqlite, bolt, postgres or redis")
+	flag.StringVar(&c.DBPath, "db", envOr("DB_PATH", "./requests.db"), "database file for the sqlite and bolt stores")
+	flag.StringVar(&c.RedisURL, "redis-url", envOr("REDIS_URL", "redis://localhost:6379/0"), "connection URL for the redis store")
+	flag.StringVar(&c.RedisPrefix, "redis-prefix", envOr("REDIS_PREFIX", "webhook-host:"), "key prefix for the redis store")
+	flag.StringVar(&c.EventsRedis, "events-redis-url", envOr("EVENTS_REDIS_URL", ""), "share live update events with other instances over Redis pub/sub at this URL")
+	flag.StringVar(&c.WALPath, "wal", envOr("WAL_PATH", ""), "append log that makes the memory store durable across restarts")
+	flag.StringVar(&c.DBURL, "db-url", envOr("DATABASE_URL", ""), "connection URL for the postgres store")
+	flag.IntVar(&c.DBMaxConns, "db-max-conns", envInt("DB_MAX_CONNS", 10), "maximum pooled connections for the postgres store")
+	c.MaxBodySize = envSize("MAX_BODY_SIZE", 0)
+	flag.Var(&c.MaxBodySize, "max-body-size", "answer larger webhook bodies with 413, keeping them truncated to this size, e.g. 10MB, 0 for no limit")
+	c.SpillThreshold = envSize("SPILL_THRESHOLD", 0)
+	flag.Var(&c.SpillThreshold, "spill-threshold", "write bodies larger than this to disk, 0 to keep all bodies in the store")
+	flag.StringVar(&c.SpillDir, "spill-dir", envOr("SPILL_DIR", "./bodies"), "directory for spilled request bodies")
+	flag.StringVar(&c.Compress, "compress", envOr("COMPRESS", "none"), "compress stored bodies: none, gzip or zstd")
+	flag.StringVar(&c.EncryptionKeyFile, "encryption-key-file", envOr("ENCRYPTION_KEY_FILE", ""), "file holding a base64 AES key used to encrypt stored URLs, headers and bodies (or set ENCRYPTION_KEY)")
+	flag.IntVar(&c.Retention.MaxRequests, "max-requests", envInt("MAX_REQUESTS", -1), "maximum requests to keep across every bin, 0 for unlimited (default 100 for the memory store, unlimited otherwise)")
+	flag.IntVar(&c.Retention.BinMaxRequests, "bin-max-requests", envInt("BIN_MAX_REQUESTS", 0), "maximum requests to keep in each bin, unless it sets its own max_requests, 0 for no cap beyond --max-requests")
+	flag.DurationVar(&c.Retention.MaxAge, "max-age", envDuration("MAX_AGE", 0), "discard requests older than this, 0 to keep forever")
+	maxMemory := envSize("MAX_MEMORY", 0)
+	flag.Var(&maxMemory, "max-memory", "approximate size cap for stored requests, e.g. 256MB, 0 for unlimited")
+	flag.StringVar(&c.Retention.Evict, "evict", envOr("EVICT", "oldest"), "which requests to evict first when over --max-memory: oldest or largest")
+	flag.DurationVar(&c.Retention.DefaultTTL, "default-ttl", envDuration("DEFAULT_TTL", 0), "expire captures after this long unless they pass their own ?ttl=, 0 to keep them")
+	flag.DurationVar(&c.PruneInterval, "prune-interval", envDuration("PRUNE_INTERVAL", time.Minute), "how often the retention janitor runs")
+	flag.StringVar(&c.PurgeCron, "purge-cron", envOr("PURGE_CRON", ""), `cron schedule for purging old requests, e.g. "0 3 * * *"`)
+	flag.DurationVar(&c.PurgeWindow, "purge-window", envDuration("PURGE_WINDOW", 24*time.Hour), "scheduled purges delete requests older than this")
+	flag.StringVar(&c.ArchiveURL, "archive-url", envOr("ARCHIVE_URL", ""), "archive requests evicted by retention to s3://bucket/prefix or gs://bucket/prefix")
+	flag.StringVar(&c.ArchiveEndpoint, "archive-endpoint", envOr("ARCHIVE_ENDPOINT", ""), "override the archive host, e.g. http://localhost:9000 for MinIO")
+	flag.StringVar(&c.ElasticURL, "es-url", envOr("ES_URL", ""), "index every capture into this Elasticsearch/OpenSearch URL")
+	flag.StringVar(&c.ElasticIndex, "es-index", envOr("ES_INDEX", "webhook-host"), "index name prefix; a -YYYY.MM.DD suffix is added per day")
+	c.ElasticAPIKey = os.Getenv("ES_API_KEY")
+	flag.StringVar(&c.ClickHouseURL, "clickhouse-url", envOr("CLICKHOUSE_URL", ""), "record an analytics row per capture in ClickHouse at this HTTP URL")
+	flag.StringVar(&c.ClickHouseTable, "clickhouse-table", envOr("CLICKHOUSE_TABLE", "webhook_requests"), "ClickHouse table for analytics rows")
+	flag.StringVar(&c.CaptureLog, "capture-log", envOr("CAPTURE_LOG", ""), "append every capture as a JSON line to this file")
+	c.CaptureLogMaxSize = envSize("CAPTURE_LOG_MAX_SIZE", 100<<20)
+	flag.Var(&c.CaptureLogMaxSize, "capture-log-max-size", "rotate the capture log once it reaches this size, 0 to disable")
+	flag.BoolVar(&c.CaptureLogDaily, "capture-log-daily", os.Getenv("CAPTURE_LOG_DAILY") == "true", "also rotate the capture log when the date changes")
+	flag.IntVar(&c.CaptureLogKeep, "capture-log-keep", envInt("CAPTURE_LOG_KEEP", 0), "rotated capture logs to keep, 0 to keep all")
+	flag.StringVar(&c.NotifyExec, "notify-exec", envOr("NOTIFY_EXEC", ""), "shell command to run for each capture, given the capture as JSON on stdin")
+	flag.StringVar(&c.NotifyExecFilter, "notify-exec-filter", envOr("NOTIFY_EXEC_FILTER", ""), `only run --notify-exec for captures matching these list filters, e.g. "method=POST&path=/stripe"`)
+	flag.StringVar(&c.NotificationsFile, "notifications-file", envOr("NOTIFICATIONS_FILE", ""), "keep notification URLs registered through the API in this JSON file, empty to keep them in memory")
+	flag.StringVar(&c.BinsFile, "bins-file", envOr("BINS_FILE", ""), "keep bins created through the API in this JSON file, empty to keep them in memory")
+	flag.StringVar(&c.UsersFile, "users-file", envOr("USERS_FILE", ""), "keep user accounts in this JSON file, empty to keep them in memory")
+	flag.BoolVar(&c.Signup, "signup", os.Getenv("SIGNUP") != "false", "let anyone create an account through /api/v1/signup")
+	flag.StringVar(&c.SessionKey, "session-key", envOr("SESSION_KEY", ""), "secret signing login sessions; without one logins end when the server restarts")
+	flag.StringVar(&c.AnonymousRole, "anonymous-role", envOr("ANONYMOUS_ROLE", "editor"), "what callers who aren't logged in may do: none, viewer, editor or admin")
+	flag.StringVar(&c.DefaultRole, "default-role", envOr("DEFAULT_ROLE", "editor"), "role of new accounts: none, viewer or editor")
+	flag.StringVar(&c.AdminUser, "admin-user", envOr("ADMIN_USER", ""), "make this account an admin at startup, creating it with --admin-password if needed; no other account starts as one")
+	flag.StringVar(&c.AdminPassword, "admin-password", envOr("ADMIN_PASSWORD", ""), "password for creating the --admin-user account")
+	flag.StringVar(&c.AuditLog, "audit-log", envOr("AUDIT_LOG", ""), "append changes made through the API, and exports, as JSON lines to this file, empty to keep the newest in memory only")
+	flag.StringVar(&c.PublicURL, "public-url", envOr("PUBLIC_URL", ""), "scheme and host the server is reached at, e.g. https://hooks.example.com, for login redirects behind a proxy")
+	flag.StringVar(&c.GitHubClientID, "github-client-id", envOr("GITHUB_CLIENT_ID", ""), "OAuth app client ID enabling login with GitHub")
+	flag.StringVar(&c.GitHubClientSecret, "github-client-secret", envOr("GITHUB_CLIENT_SECRET", ""), "OAuth app client secret for --github-client-id")
+	flag.StringVar(&c.GoogleClientID, "google-client-id", envOr("GOOGLE_CLIENT_ID", ""), "OAuth client ID enabling login with Google")
+	flag.StringVar(&c.GoogleClientSecret, "google-client-secret", envOr("GOOGLE_CLIENT_SECRET", ""), "OAuth client secret for --google-client-id")
+	flag.StringVar(&c.OIDCIssuer, "oidc-issuer", envOr("OIDC_ISSUER", ""), "OpenID Connect issuer URL enabling login through it, discovered at startup")
+	flag.StringVar(&c.OIDCClientID, "oidc-client-id", envOr("OIDC_CLIENT_ID", ""), "client ID registered with --oidc-issuer")
+	flag.StringVar(&c.OIDCClientSecret, "oidc-client-secret", envOr("OIDC_CLIENT_SECRET", ""), "client secret registered with --oidc-issuer")
+	flag.StringVar(&c.OAuthAllowedDomains, "oauth-allowed-domains", envOr("OAUTH_ALLOWED_DOMAINS", ""), "comma separated email domains allowed to log in through a provider, empty to allow any account")
+	flag.StringVar(&c.BinDomain, "bin-domain", envOr("BIN_DOMAIN", ""), "with a wildcard DNS record, capture requests to <token>.<this domain> into bin <token>, e.g. hooks.example.com")
+	flag.DurationVar(&c.BinTTL, "bin-ttl", envDuration("BIN_TTL", 0), "expire created bins after this long unless they set their own expires_in, 0 to keep them forever")
+	flag.IntVar(&c.BinRateLimit, "bin-rate-limit", envInt("BIN_RATE_LIMIT", 0), "answer a bin's webhooks beyond this many a minute with 429, each bin counted separately, 0 for no limit")
+	c.BinMaxStorage = envSize("BIN_MAX_STORAGE", 0)
+	flag.Var(&c.BinMaxStorage, "bin-max-storage", "answer a bin's webhooks with 429 once its captures take up this much, e.g. 50MB, 0 for no limit")
+	flag.IntVar(&c.ResponseStatus, "response-status", envInt("RESPONSE_STATUS", http.StatusOK), "status webhooks are answered with, unless their bin sets its own response")
+	flag.StringVar(&c.ResponseContentType, "response-content-type", envOr("RESPONSE_CONTENT_TYPE", ""), "Content-Type of the answer to webhooks, by default JSON for a JSON body and plain text otherwise")
+	c.ResponseHeaders = envHeaders("RESPONSE_HEADERS")
+	flag.Var(&c.ResponseHeaders, "response-header", `header to answer webhooks with, as "Name: value"; repeat for more, or separate them with newlines in RESPONSE_HEADERS`)
+	flag.StringVar(&c.ResponseBody, "response-body", envSet("RESPONSE_BODY", webhookReply), `body webhooks are answered with; --response-body="" with --response-status 204, or RESPONSE_BODY set empty, for an empty answer`)
+	flag.BoolVar(&c.ResponseTemplate, "response-template", os.Getenv("RESPONSE_TEMPLATE") == "true", `treat --response-body and --response-header values as Go templates over the capture, e.g. {{json "challenge"}}`)
+	flag.BoolVar(&c.Echo, "echo", os.Getenv("ECHO") == "true", "answer every webhook with its own body and Content-Type, as requests below /echo/ always are")
+	flag.StringVar(&c.EchoHeaders, "echo-headers", envOr("ECHO_HEADERS", ""), "comma separated request headers to mirror in echoed answers besides Content-Type and Content-Encoding")
+	flag.StringVar(&c.RulesFile, "rules-file", envOr("RULES_FILE", ""), "keep rules answering matching webhooks with canned responses in this JSON file, empty to keep them in memory")
+	flag.BoolVar(&c.RawDump, "raw-dump", os.Getenv("RAW_DUMP") == "true", "also keep each request in wire format, byte for byte on plain HTTP, for signatures that depend on header order")
+	flag.BoolVar(&c.TUI, "tui", false, "browse captures in an interactive terminal UI instead of logging to stdout")
+	flag.Parse()
+
+	c.Retention.MaxMemory = int64(maxMemory)
+	if c.Retention.MaxRequests < 0 {
+		c.Retention.MaxRequests = 0
+		if c.Store == "memory" {
+			// Keep the in-memory store bounded by default to avoid memory issues
+			c.Retention.MaxRequests = 100
+		}
+	}
+	return c
+}
+
+// envOr returns the environment variable key, or def when it is unset or
+// empty
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envSet is envOr for settings where empty is a value of its own, returning
+// def only when key is unset
+func envSet(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+// envInt is envOr for integer settings; unparsable values fall back to def
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// envDuration is envOr for duration settings; unparsable values fall back to def
+func envDuration(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// headerList collects "Name: value" headers from a repeated flag; the first
+// flag replaces those read from the environment
+type headerList struct {
+	headers []string
+	flagged bool
+}
+
+func (h *headerList) String() string { return strings.Join(h.headers, "\n") }
+
+func (h *headerList) Set(v string) error {
+	if !h.flagged {
+		h.headers, h.flagged = nil, true
+	}
+	h.headers = append(h.headers, v)
+	return nil
+}
+
+// envHeaders reads newline separated headers from the environment variable key
+func envHeaders(key string) headerList {
+	var h headerList
+	for _, line := range strings.Split(os.Getenv(key), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			h.headers = append(h.headers, line)
+		}
+	}
+	return h
+}
+
+// envSize is envOr for byte sizes; unparsable values fall back to def
+func envSize(key string, def byteSize) byteSize {
+	if v, err := parseSize(os.Getenv(key)); err == nil && os.Getenv(key) != "" {
+		return v
+	}
+	return def
+}
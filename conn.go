@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// connStatsKey is the context key for a connection's *connStats
+type connStatsKey struct{}
+
+// connStats counts the requests served on one client connection, so a
+// capture can tell whether its connection was reused
+type connStats struct {
+	requests atomic.Int64
+	// fingerprint is set during the TLS handshake on HTTPS connections
+	fingerprint atomic.Pointer[TLSFingerprint]
+	// raw records the connection's bytes with --raw-dump on plain HTTP
+	raw *recordingConn
+}
+
+// requestNumberKey is the context key for a request's place on its
+// connection, counted from 1
+type requestNumberKey struct{}
+
+// newServer returns a server for handler that tracks per-connection request
+// counts for connRequestNumber
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:    addr,
+		Handler: countConnRequests(handler),
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			stats := &connStats{}
+			stats.raw, _ = c.(*recordingConn)
+			return context.WithValue(ctx, connStatsKey{}, stats)
+		},
+	}
+}
+
+// countConnRequests numbers each request on its connection before passing
+// it to next, and afterwards clears any raw recording for the next request
+func countConnRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats, ok := r.Context().Value(connStatsKey{}).(*connStats)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		n := stats.requests.Add(1)
+		r = r.WithContext(context.WithValue(r.Context(), requestNumberKey{}, int(n)))
+		next.ServeHTTP(w, r)
+		// The response isn't flushed yet, so a client waiting on it can't
+		// have sent its next request
+		if stats.raw != nil {
+			stats.raw.reset()
+		}
+	})
+}
+
+// connRequestNumber returns r's place on its connection, 1 for the first
+// request, or 0 when it wasn't counted
+func connRequestNumber(r *http.Request) int {
+	n, _ := r.Context().Value(requestNumberKey{}).(int)
+	return n
+}
+
+// connFingerprint returns the TLS fingerprint of r's connection, or nil
+func connFingerprint(r *http.Request) *TLSFingerprint {
+	if stats, ok := r.Context().Value(connStatsKey{}).(*connStats); ok {
+		return stats.fingerprint.Load()
+	}
+	return nil
+}
+
+// localAddr returns the listener address r arrived on, or ""
+func localAddr(r *http.Request) string {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		return addr.String()
+	}
+	return ""
+}
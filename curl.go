@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// replaySkipHeaders are left out when a capture is rebuilt for replay,
+// because the client sending it computes them afresh
+var replaySkipHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Host":              true,
+	"Connection":        true,
+	"Accept-Encoding":   true,
+	"Transfer-Encoding": true,
+}
+
+// replaySkips reports whether header k is left out when info is rebuilt for
+// replay. A decompressed body is replayed as stored, so its Content-Encoding
+// goes too.
+func replaySkips(info RequestInfo, k string) bool {
+	return replaySkipHeaders[k] || k == "Content-Encoding" && info.DecodedFrom != ""
+}
+
+// curlHandler renders one capture as a curl command. ?target=<url> replaces
+// this server's scheme and host, so the webhook can be replayed against a
+// local service.
+func curlHandler(w http.ResponseWriter, r *http.Request) {
+	base := requestBase(r)
+	if target := r.URL.Query().Get("target"); target != "" {
+		u, err := url.Parse(target)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			http.Error(w, "Invalid target URL", http.StatusBadRequest)
+			return
+		}
+		base = strings.TrimSuffix(target, "/")
+	}
+	info, ok := requestFromPath(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, curlCommand(info, base))
+}
+
+// curlCommand builds a shell-safe curl invocation reproducing info against
+// base, one option per line. Binary bodies are piped in through base64 -d.
+func curlCommand(info RequestInfo, base string) string {
+	parts := []string{"curl -X " + shellQuote(info.Method)}
+	prefix := ""
+
+	keys := make([]string, 0, len(info.Headers))
+	for k := range info.Headers {
+		if !replaySkips(info, k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range info.Headers[k] {
+			parts = append(parts, "-H "+shellQuote(k+": "+v))
+		}
+	}
+	switch {
+	case info.BodyEncoding == "base64":
+		prefix = "printf %s " + shellQuote(info.Body) + " | base64 -d | "
+		parts = append(parts, "--data-binary @-")
+	case info.Body != "":
+		parts = append(parts, "--data-binary "+shellQuote(info.Body))
+	}
+	parts = append(parts, shellQuote(base+info.URL))
+	return prefix + strings.Join(parts, " \\\n  ")
+}
+
+// shellQuote wraps s in single quotes for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxDecodedBody bounds a decompressed request body, so a small compressed
+// payload can't expand to exhaust memory
+const maxDecodedBody = 64 << 20
+
+// contentEncodings lists a request's Content-Encoding codings in the order
+// they were applied, leaving out identity
+func contentEncodings(h Header) []string {
+	var out []string
+	for _, v := range h["Content-Encoding"] {
+		for _, c := range strings.Split(v, ",") {
+			if c = strings.ToLower(strings.TrimSpace(c)); c != "" && c != "identity" {
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// decodeBody undoes codings, last applied first. It reports false, leaving
+// the caller to keep body as it arrived, for unknown codings, corrupt data
+// and results over maxDecodedBody.
+func decodeBody(codings []string, body []byte) ([]byte, bool) {
+	if len(codings) == 0 || len(body) == 0 {
+		return nil, false
+	}
+	for _, c := range slices.Backward(codings) {
+		decoded, err := decodeCoding(c, body)
+		if err != nil {
+			return nil, false
+		}
+		body = decoded
+	}
+	return body, true
+}
+
+func decodeCoding(coding string, data []byte) ([]byte, error) {
+	var r io.Reader
+	switch coding {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case "deflate":
+		// Meant to be zlib-wrapped, but some senders send raw deflate
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			r = flate.NewReader(bytes.NewReader(data))
+		} else {
+			r = zr
+		}
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(data))
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", coding)
+	}
+	out, err := io.ReadAll(io.LimitReader(r, maxDecodedBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxDecodedBody {
+		return nil, fmt.Errorf("decoded body exceeds %d bytes", maxDecodedBody)
+	}
+	return out, nil
+}
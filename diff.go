@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// requestDiff describes how capture B differs from capture A. Method and URL
+// are only present when they differ.
+type requestDiff struct {
+	A       int           `json:"a"`
+	B       int           `json:"b"`
+	Method  *fieldChange  `json:"method,omitempty"`
+	URL     *fieldChange  `json:"url,omitempty"`
+	Headers []fieldChange `json:"headers"`
+	// BodyFormat is "json" when both bodies parse as JSON and Body lists
+	// changes per JSON path; otherwise it is "text" and Body holds at most
+	// one change to the whole body
+	BodyFormat string        `json:"body_format"`
+	Body       []fieldChange `json:"body"`
+}
+
+// fieldChange is one difference. Op is added, removed or changed; A and B
+// hold the old and new values where they exist.
+type fieldChange struct {
+	Path string `json:"path"`
+	Op   string `json:"op"`
+	A    any    `json:"a,omitempty"`
+	B    any    `json:"b,omitempty"`
+}
+
+// diffHandler compares the captures named by ?a= and ?b=
+func diffHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("a") == "" || q.Get("b") == "" {
+		http.Error(w, "Missing a or b parameter", http.StatusBadRequest)
+		return
+	}
+	a, ok := requestByID(w, r, q.Get("a"))
+	if !ok {
+		return
+	}
+	b, ok := requestByID(w, r, q.Get("b"))
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diffRequests(a, b))
+}
+
+func diffRequests(a, b RequestInfo) requestDiff {
+	d := requestDiff{A: a.ID, B: b.ID, Headers: []fieldChange{}, Body: []fieldChange{}}
+	if a.Method != b.Method {
+		d.Method = &fieldChange{Path: "method", Op: "changed", A: a.Method, B: b.Method}
+	}
+	if a.URL != b.URL {
+		d.URL = &fieldChange{Path: "url", Op: "changed", A: a.URL, B: b.URL}
+	}
+
+	names := make([]string, 0, len(a.Headers)+len(b.Headers))
+	for k := range a.Headers {
+		names = append(names, k)
+	}
+	for k := range b.Headers {
+		if _, ok := a.Headers[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	slices.Sort(names)
+	for _, k := range names {
+		// Repeated headers compare as their comma-joined values
+		av, inA := a.Headers[k]
+		bv, inB := b.Headers[k]
+		as, bs := strings.Join(av, ", "), strings.Join(bv, ", ")
+		switch {
+		case !inA:
+			d.Headers = append(d.Headers, fieldChange{Path: k, Op: "added", B: bs})
+		case !inB:
+			d.Headers = append(d.Headers, fieldChange{Path: k, Op: "removed", A: as})
+		case as != bs:
+			d.Headers = append(d.Headers, fieldChange{Path: k, Op: "changed", A: as, B: bs})
+		}
+	}
+
+	av, aErr := decodeJSONBody(a.Body)
+	bv, bErr := decodeJSONBody(b.Body)
+	if aErr == nil && bErr == nil {
+		d.BodyFormat = "json"
+		d.Body = diffJSON("$", av, bv, d.Body)
+	} else {
+		d.BodyFormat = "text"
+		if a.Body != b.Body {
+			d.Body = append(d.Body, fieldChange{Path: "body", Op: "changed", A: a.Body, B: b.Body})
+		}
+	}
+	return d
+}
+
+// decodeJSONBody parses body as a single JSON value, keeping numbers exact
+func decodeJSONBody(body string) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("trailing data after JSON value")
+	}
+	return v, nil
+}
+
+// diffJSON appends the differences between two decoded JSON values at path
+func diffJSON(path string, a, b any, out []fieldChange) []fieldChange {
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			p := jsonPathKey(path, k)
+			ak, inA := av[k]
+			bk, inB := bv[k]
+			switch {
+			case !inA:
+				out = append(out, fieldChange{Path: p, Op: "added", B: bk})
+			case !inB:
+				out = append(out, fieldChange{Path: p, Op: "removed", A: ak})
+			default:
+				out = diffJSON(p, ak, bk, out)
+			}
+		}
+		return out
+	case []any:
+		bv, ok := b.([]any)
+		if !ok {
+			break
+		}
+		for i := range max(len(av), len(bv)) {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(av):
+				out = append(out, fieldChange{Path: p, Op: "added", B: bv[i]})
+			case i >= len(bv):
+				out = append(out, fieldChange{Path: p, Op: "removed", A: av[i]})
+			default:
+				out = diffJSON(p, av[i], bv[i], out)
+			}
+		}
+		return out
+	}
+	if !jsonEqual(a, b) {
+		out = append(out, fieldChange{Path: path, Op: "changed", A: a, B: b})
+	}
+	return out
+}
+
+// jsonEqual compares decoded JSON values by their encoding
+func jsonEqual(a, b any) bool {
+	ab, _ := json.Marshal(a)
+	bb, _ := json.Marshal(b)
+	return bytes.Equal(ab, bb)
+}
+
+var jsonIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// jsonPathKey extends a JSONPath with an object key, bracket-quoting keys
+// that aren't plain identifiers
+func jsonPathKey(path, key string) string {
+	if jsonIdentifier.MatchString(key) {
+		return path + "." + key
+	}
+	quoted, _ := json.Marshal(key)
+	return path + "[" + string(quoted) + "]"
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// echoHeaders are the request headers an echo reply mirrors besides
+// Content-Type and Content-Encoding, from --echo-headers
+var echoHeaders []string
+
+// echoKey is the context key marking a request sent below /echo/
+type echoKey struct{}
+
+// echoHandler captures a request like any other webhook and answers with
+// it, whatever the bin or --echo say
+func echoHandler(w http.ResponseWriter, r *http.Request) {
+	webhookHandler(w, r.WithContext(context.WithValue(r.Context(), echoKey{}, true)))
+}
+
+// echoRequested reports whether r came in below /echo/
+func echoRequested(r *http.Request) bool {
+	echo, _ := r.Context().Value(echoKey{}).(bool)
+	return echo
+}
+
+// echo returns rep answering with r's body as received, compressed or not,
+// its Content-Type and Content-Encoding and the --echo-headers, so a client
+// sees exactly what it serialized. rep's own headers go on top.
+func (rep Reply) echo(r *http.Request, body []byte) Reply {
+	out := Reply{Status: rep.Status, Headers: map[string]string{}, Body: string(body), Echo: true}
+	for _, name := range append([]string{"Content-Type", "Content-Encoding"}, echoHeaders...) {
+		if v := r.Header.Values(name); len(v) > 0 {
+			out.Headers[http.CanonicalHeaderKey(name)] = strings.Join(v, ", ")
+		}
+	}
+	for k, v := range rep.Headers {
+		out.Headers[k] = v
+	}
+	if _, ok := out.Headers["Content-Type"]; !ok {
+		// Don't let an untyped body be sniffed as something it isn't
+		out.Headers["Content-Type"] = "application/octet-stream"
+	}
+	return out
+}
+
+// recorded returns rep as a capture keeps it: an echoed body is the request
+// body, so it isn't stored twice
+func (rep Reply) recorded() Reply {
+	if rep.Echo {
+		rep.Body = ""
+	}
+	return rep
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"maps"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReplyEcho(t *testing.T) {
+	echoHeaders = []string{"X-Trace"}
+	defer func() { echoHeaders = nil }()
+	r := httptest.NewRequest("POST", "/echo/hook", strings.NewReader(""))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Trace", "t1")
+	r.Header.Set("X-Other", "dropped")
+	body := []byte(`{"a":1}`)
+	tests := []struct {
+		name string
+		rep  Reply
+		want map[string]string
+	}{
+		{"request headers mirrored", Reply{Status: 201}, map[string]string{"Content-Type": "application/json", "X-Trace": "t1"}},
+		{"reply headers on top", Reply{Headers: map[string]string{"X-Trace": "mine"}}, map[string]string{"Content-Type": "application/json", "X-Trace": "mine"}},
+	}
+	for _, tt := range tests {
+		got := tt.rep.echo(r, body)
+		if got.Status != tt.rep.Status || got.Body != string(body) || !got.Echo || !maps.Equal(got.Headers, tt.want) {
+			t.Errorf("%s: echo = %+v, want headers %v", tt.name, got, tt.want)
+		}
+		if got.recorded().Body != "" {
+			t.Errorf("%s: recorded reply keeps the echoed body", tt.name)
+		}
+	}
+	untyped := httptest.NewRequest("POST", "/echo/hook", nil)
+	if got := (Reply{}).echo(untyped, []byte("x")).Headers["Content-Type"]; got != "application/octet-stream" {
+		t.Errorf("untyped echo Content-Type = %q", got)
+	}
+}
+
+func TestTemplateReplyKeepsEcho(t *testing.T) {
+	rep := Reply{Status: 202, Headers: map[string]string{"X-Id": "{{header \"X-Id\"}}"}, Template: true, Echo: true}
+	got, err := rep.render(RequestInfo{Headers: Header{"X-Id": {"42"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Echo || got.Status != 202 || got.Headers["X-Id"] != "42" {
+		t.Errorf("render = %+v, want echo kept with headers rendered", got)
+	}
+}
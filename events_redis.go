@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisEventQueueSize bounds the events waiting to be published, so a slow
+// Redis never delays captures
+const redisEventQueueSize = 1000
+
+// redisEvents relays store events between instances sharing a store over
+// Redis pub/sub, so streaming clients on any instance see every change.
+// Each instance publishes its own changes tagged with a random origin and
+// passes on the ones from other origins to its local hub. Messages carry
+// only IDs; receivers load the request from the shared store, so bodies
+// never cross the channel in the clear.
+type redisEvents struct {
+	rdb     *redis.Client
+	channel string
+	origin  string
+	out     chan captureEvent
+}
+
+// redisEventMessage is the pub/sub payload
+type redisEventMessage struct {
+	Origin string       `json:"origin"`
+	Event  captureEvent `json:"event"`
+}
+
+// fanout relays local events to other instances when set
+var fanout *redisEvents
+
+func newRedisEvents(url, channel string) (*redisEvents, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	rdb := redis.NewClient(opts)
+	ctx := context.Background()
+	sub := rdb.Subscribe(ctx, channel)
+	// Wait for the subscription so no event published after startup is missed
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		rdb.Close()
+		return nil, err
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	e := &redisEvents{
+		rdb:     rdb,
+		channel: channel,
+		origin:  hex.EncodeToString(b),
+		out:     make(chan captureEvent, redisEventQueueSize),
+	}
+	go e.receive(sub)
+	go e.send()
+	return e, nil
+}
+
+// publish queues a locally made change for the other instances
+func (e *redisEvents) publish(ev captureEvent) {
+	select {
+	case e.out <- ev:
+	default:
+		log.Printf("Event fan-out queue full, dropping %s event", ev.Type)
+	}
+}
+
+func (e *redisEvents) send() {
+	for ev := range e.out {
+		ev.Request = nil
+		data, err := json.Marshal(redisEventMessage{Origin: e.origin, Event: ev})
+		if err != nil {
+			log.Printf("Failed to encode %s event: %v", ev.Type, err)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = e.rdb.Publish(ctx, e.channel, data).Err()
+		cancel()
+		if err != nil {
+			log.Printf("Failed to publish %s event: %v", ev.Type, err)
+		}
+	}
+}
+
+func (e *redisEvents) receive(sub *redis.PubSub) {
+	// go-redis resubscribes by itself after a dropped connection
+	for msg := range sub.Channel() {
+		var m redisEventMessage
+		if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+			log.Printf("Ignoring malformed event: %v", err)
+			continue
+		}
+		if m.Origin == e.origin {
+			continue
+		}
+		ev := m.Event
+		if ev.Type == "request" || ev.Type == "update" {
+			info, err := store.Get(ev.ID)
+			if err != nil {
+				// Deleted again already, or not visible to this instance
+				continue
+			}
+			ev.Request = &info
+		}
+		captures.publish(ev)
+	}
+}
+
+// broadcast delivers ev to local subscribers and, when fan-out is on, to
+// every other instance
+func broadcast(ev captureEvent) {
+	captures.publish(ev)
+	if fanout != nil {
+		fanout.publish(ev)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// exportVersion is bumped when the archive layout changes incompatibly
+const exportVersion = 1
+
+// Archive is the document produced by /api/v1/export and accepted by /api/v1/import
+type Archive struct {
+	Version    int           `json:"version"`
+	ExportedAt time.Time     `json:"exported_at"`
+	Requests   []RequestInfo `json:"requests"`
+}
+
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := store.List()
+	if err == nil {
+		list = Filter{Bin: r.URL.Query().Get("bin")}.apply(list)
+		err = hydrateBodies(list)
+	}
+	if err != nil {
+		http.Error(w, "Failed to export requests", http.StatusInternalServerError)
+		return
+	}
+	archive := Archive{Version: exportVersion, ExportedAt: time.Now(), Requests: list}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="webhook-host-%s.json"`, archive.ExportedAt.Format("20060102-150405")))
+	json.NewEncoder(w).Encode(archive)
+}
+
+// streamFlushEvery is how many requests streamExportHandler writes between flushes
+const streamFlushEvery = 100
+
+// streamExportHandler streams the requests matching the usual filter
+// parameters without loading the whole history into memory. ?format=ndjson,
+// the default, writes one full capture per line; ?format=har writes a HAR 1.2
+// log for browser devtools and other HAR viewers.
+func streamExportHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+	if format != "ndjson" && format != "har" {
+		http.Error(w, fmt.Sprintf("Unsupported export format %q", format), http.StatusBadRequest)
+		return
+	}
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Only the matching IDs are gathered up front, and each capture is
+	// loaded as it's written, so a slow client never holds the store's
+	// connection or a read transaction open
+	var ids []int
+	err = store.Each(func(info RequestInfo) error {
+		if filter.Match(info) {
+			ids = append(ids, info.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, "Failed to export requests", http.StatusInternalServerError)
+		return
+	}
+	filename := "webhook-host-" + time.Now().Format("20060102-150405")
+	if format == "har" {
+		w.Header().Set("Content-Type", "application/json")
+		filename += ".har"
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		filename += ".ndjson"
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	base := requestBase(r)
+	if format == "har" {
+		// The entries are streamed between a hand-written header and footer
+		creator, _ := json.Marshal(harCreator{Name: "webhook-host", Version: strconv.Itoa(exportVersion)})
+		fmt.Fprintf(w, `{"log":{"version":"1.2","creator":%s,"entries":[`, creator)
+	}
+	written := 0
+	for _, id := range ids {
+		info, err := store.Get(id)
+		if errors.Is(err, ErrNotFound) {
+			// Deleted since the IDs were gathered
+			continue
+		}
+		if err == nil {
+			if format == "har" {
+				if written > 0 {
+					io.WriteString(w, ",")
+				}
+				err = enc.Encode(newHAREntry(info, base))
+			} else {
+				err = enc.Encode(info)
+			}
+		}
+		if err != nil {
+			// Headers are already sent, so a truncated stream is all the client sees
+			log.Printf("%s export stopped after %d requests: %v", format, written, err)
+			return
+		}
+		if written++; written%streamFlushEvery == 0 {
+			rc.Flush()
+		}
+	}
+	if format == "har" {
+		io.WriteString(w, "]}}\n")
+	}
+}
+
+type importResponse struct {
+	Imported int `json:"imported"`
+}
+
+// importHandler restores an archive. Requests receive fresh IDs from the store;
+// pass ?replace=true to clear the existing history first, which, like
+// /clear, leaves protected bins alone. Captures for a protected bin need its
+// credentials.
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var archive Archive
+	if err := json.NewDecoder(r.Body).Decode(&archive); err != nil {
+		http.Error(w, "Invalid archive", http.StatusBadRequest)
+		return
+	}
+	if archive.Version != exportVersion {
+		http.Error(w, fmt.Sprintf("Unsupported archive version %d", archive.Version), http.StatusBadRequest)
+		return
+	}
+	for _, info := range archive.Requests {
+		if bins.protected(info.Bin) && (!canReadBin(r, info.Bin) || !inScope(r, info.Bin)) {
+			binUnauthorized(w, info.Bin)
+			return
+		}
+	}
+	if r.URL.Query().Get("replace") == "true" {
+		if err := clearRequests(true, ""); err != nil {
+			http.Error(w, "Failed to clear requests", http.StatusInternalServerError)
+			return
+		}
+	}
+	// Archives list newest first; add oldest first so ordering is preserved
+	imported := 0
+	for i := len(archive.Requests) - 1; i >= 0; i-- {
+		if err := addImported(archive.Requests[i]); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to import request %d of %d", imported+1, len(archive.Requests)), http.StatusInternalServerError)
+			return
+		}
+		imported++
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(importResponse{Imported: imported})
+}
+
+// addImported stores a request read from an archive or backup. It gets a
+// fresh ID, and storage bookkeeping from the source instance is dropped.
+func addImported(info RequestInfo) error {
+	info.BodyRef, info.BodyCompression, info.Sealed, info.Seen = "", "", "", 0
+	return store.Add(&info)
+}
+
+// hydrateBodies replaces spilled body previews in list with the full bodies
+func hydrateBodies(list []RequestInfo) error {
+	for i := range list {
+		if list[i].BodyRef == "" {
+			continue
+		}
+		full, err := store.Get(list[i].ID)
+		if err != nil {
+			return err
+		}
+		list[i] = full
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TLSFingerprint identifies the TLS client library that opened a connection
+// from its ClientHello, which curl, Go, browsers and the big webhook senders'
+// stacks all build differently
+type TLSFingerprint struct {
+	JA3     string `json:"ja3"`
+	JA3Hash string `json:"ja3_hash"`
+	JA4     string `json:"ja4"`
+}
+
+// helloConns maps a TLS connection's underlying net.Conn to its connStats
+// between accept and close, so the ClientHello seen during the handshake can
+// be attached to the connection's requests
+var helloConns sync.Map
+
+// fingerprintClients makes srv, which must have a TLSConfig, record a
+// TLSFingerprint for every connection
+func fingerprintClients(srv *http.Server) {
+	connContext := srv.ConnContext
+	srv.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		ctx = connContext(ctx, c)
+		if tc, ok := c.(*tls.Conn); ok {
+			if stats, ok := ctx.Value(connStatsKey{}).(*connStats); ok {
+				helloConns.Store(tc.NetConn(), stats)
+			}
+		}
+		return ctx
+	}
+	srv.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateClosed || state == http.StateHijacked {
+			if tc, ok := c.(*tls.Conn); ok {
+				helloConns.Delete(tc.NetConn())
+			}
+		}
+	}
+	srv.TLSConfig.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if v, ok := helloConns.Load(hello.Conn); ok {
+			fp := newTLSFingerprint(hello)
+			v.(*connStats).fingerprint.Store(&fp)
+		}
+		// Carry on with the server's own config
+		return nil, nil
+	}
+}
+
+// isGREASE reports whether v is one of the reserved values clients sprinkle
+// into handshakes (RFC 8701), which fingerprints leave out
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func withoutGREASE(values []uint16) []uint16 {
+	out := make([]uint16, 0, len(values))
+	for _, v := range values {
+		if !isGREASE(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Extension IDs that JA4 treats specially
+const (
+	extServerName        = 0x0000
+	extALPN              = 0x0010
+	extSupportedVersions = 0x002b
+)
+
+// newTLSFingerprint computes the JA3 and JA4 fingerprints of hello
+func newTLSFingerprint(hello *tls.ClientHelloInfo) TLSFingerprint {
+	ciphers := withoutGREASE(hello.CipherSuites)
+	extensions := withoutGREASE(hello.Extensions)
+	curves := make([]uint16, 0, len(hello.SupportedCurves))
+	for _, c := range hello.SupportedCurves {
+		curves = append(curves, uint16(c))
+	}
+	curves = withoutGREASE(curves)
+	points := make([]uint16, 0, len(hello.SupportedPoints))
+	for _, p := range hello.SupportedPoints {
+		points = append(points, uint16(p))
+	}
+	versions := withoutGREASE(hello.SupportedVersions)
+	hasVersionsExt := slices.Contains(extensions, extSupportedVersions)
+
+	// Without the supported_versions extension Go derives the list from the
+	// legacy version field, newest first. With it, the legacy field is
+	// frozen at TLS 1.2.
+	legacy := uint16(tls.VersionTLS12)
+	if !hasVersionsExt && len(versions) > 0 {
+		legacy = versions[0]
+	}
+	ja3 := strings.Join([]string{
+		strconv.Itoa(int(legacy)),
+		joinDecimal(ciphers), joinDecimal(extensions), joinDecimal(curves), joinDecimal(points),
+	}, ",")
+	sum := md5.Sum([]byte(ja3))
+
+	return TLSFingerprint{JA3: ja3, JA3Hash: hex.EncodeToString(sum[:]), JA4: ja4(hello, ciphers, extensions, versions)}
+}
+
+// ja4 builds the JA4 fingerprint, such as t13d1516h2_8daaf6152771_e5627efa2ab1
+func ja4(hello *tls.ClientHelloInfo, ciphers, extensions, versions []uint16) string {
+	version := "00"
+	if len(versions) > 0 {
+		switch slices.Max(versions) {
+		case tls.VersionTLS13:
+			version = "13"
+		case tls.VersionTLS12:
+			version = "12"
+		case tls.VersionTLS11:
+			version = "11"
+		case tls.VersionTLS10:
+			version = "10"
+		case 0x0300: // SSL 3.0
+			version = "s3"
+		}
+	}
+	sni := "i"
+	if slices.Contains(extensions, extServerName) {
+		sni = "d"
+	}
+	alpn := "00"
+	if len(hello.SupportedProtos) > 0 && hello.SupportedProtos[0] != "" {
+		p := hello.SupportedProtos[0]
+		first, last := p[0], p[len(p)-1]
+		if isAlnum(first) && isAlnum(last) {
+			alpn = string([]byte{first, last})
+		} else {
+			h := hex.EncodeToString([]byte(p))
+			alpn = string([]byte{h[0], h[len(h)-1]})
+		}
+	}
+	a := fmt.Sprintf("t%s%s%02d%02d%s", version, sni, min(len(ciphers), 99), min(len(extensions), 99), alpn)
+
+	sorted := slices.Sorted(slices.Values(ciphers))
+	b := truncatedHash(joinHex(sorted))
+
+	var rest []uint16
+	for _, e := range extensions {
+		if e != extServerName && e != extALPN {
+			rest = append(rest, e)
+		}
+	}
+	c := joinHex(slices.Sorted(slices.Values(rest)))
+	if len(hello.SignatureSchemes) > 0 {
+		schemes := make([]uint16, len(hello.SignatureSchemes))
+		for i, s := range hello.SignatureSchemes {
+			schemes[i] = uint16(s)
+		}
+		c += "_" + joinHex(schemes)
+	}
+	if len(rest) == 0 {
+		c = ""
+	}
+	return a + "_" + b + "_" + truncatedHash(c)
+}
+
+// truncatedHash is JA4's 12 hex digit SHA-256 prefix, all zeros for an empty
+// list
+func truncatedHash(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func joinDecimal(values []uint16) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(int(v))
+	}
+	return strings.Join(parts, "-")
+}
+
+func joinHex(values []uint16) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
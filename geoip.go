@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// Geo locates the sender of a capture, from the MaxMind databases given with
+// --geoip-db
+type Geo struct {
+	Country     string `json:"country,omitempty"` // ISO 3166 code, such as US
+	CountryName string `json:"country_name,omitempty"`
+	City        string `json:"city,omitempty"`
+	ASN         uint   `json:"asn,omitempty"`
+	ASOrg       string `json:"as_org,omitempty"` // organisation owning the ASN
+}
+
+// geoDBs are the open --geoip-db databases. Country or City databases and
+// ASN databases hold different fields, so every one is consulted.
+var geoDBs []*maxminddb.Reader
+
+// geoRecord holds the fields of GeoIP2/GeoLite2 Country, City and ASN
+// records that Geo keeps
+type geoRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// openGeoDBs opens the comma separated .mmdb files in paths
+func openGeoDBs(paths string) error {
+	for _, path := range strings.Split(paths, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		db, err := maxminddb.Open(path)
+		if err != nil {
+			return err
+		}
+		geoDBs = append(geoDBs, db)
+	}
+	return nil
+}
+
+// geoSummary renders g as "City, CC · AS123 Org"
+func geoSummary(g *Geo) string {
+	var place []string
+	for _, p := range []string{g.City, g.Country} {
+		if p != "" {
+			place = append(place, p)
+		}
+	}
+	parts := []string{strings.Join(place, ", ")}
+	if g.ASN != 0 {
+		parts = append(parts, strings.TrimSpace(fmt.Sprintf("AS%d %s", g.ASN, g.ASOrg)))
+	}
+	return strings.TrimPrefix(strings.Join(parts, " · "), " · ")
+}
+
+// lookupGeo returns what the databases know about ip, or nil when there are
+// none, ip is private or nothing was found
+func lookupGeo(ip string) *Geo {
+	if len(geoDBs) == 0 {
+		return nil
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap()
+	if addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsUnspecified() {
+		return nil
+	}
+	var geo Geo
+	for _, db := range geoDBs {
+		var rec geoRecord
+		if err := db.Lookup(addr).Decode(&rec); err != nil {
+			continue
+		}
+		if rec.Country.ISOCode != "" {
+			geo.Country, geo.CountryName = rec.Country.ISOCode, rec.Country.Names["en"]
+		}
+		if name := rec.City.Names["en"]; name != "" {
+			geo.City = name
+		}
+		if rec.ASN != 0 {
+			geo.ASN, geo.ASOrg = rec.ASN, rec.ASOrg
+		}
+	}
+	if geo == (Geo{}) {
+		return nil
+	}
+	return &geo
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// GraphQL is the operation carried by a GraphQL request
+type GraphQL struct {
+	OperationName string          `json:"operation_name,omitempty"`
+	OperationType string          `json:"operation_type"` // query, mutation or subscription
+	Query         string          `json:"query"`
+	Variables     json.RawMessage `json:"variables,omitempty"`
+}
+
+// graphQLOperation matches the first operation definition in a document,
+// at its start or after an earlier definition such as a fragment
+var graphQLOperation = regexp.MustCompile(`(?:^|\})\s*(query|mutation|subscription)\b\s*([_A-Za-z][_0-9A-Za-z]*)?`)
+
+// parseGraphQL recognises GraphQL over HTTP: a JSON POST with a query
+// string, an application/graphql POST, or a GET with ?query=. It returns
+// nil for anything else.
+func parseGraphQL(r *http.Request, body []byte) *GraphQL {
+	var gql GraphQL
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case r.Method == http.MethodGet && r.URL.Query().Has("query"):
+		q := r.URL.Query()
+		gql.Query, gql.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); json.Valid([]byte(v)) {
+			gql.Variables = json.RawMessage(v)
+		}
+	case mediaType == "application/graphql":
+		gql.Query = string(body)
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var req struct {
+			Query         *string         `json:"query"`
+			OperationName string          `json:"operationName"`
+			Variables     json.RawMessage `json:"variables"`
+		}
+		if json.Unmarshal(body, &req) != nil || req.Query == nil {
+			return nil
+		}
+		gql.Query, gql.OperationName, gql.Variables = *req.Query, req.OperationName, req.Variables
+		if string(gql.Variables) == "null" {
+			gql.Variables = nil
+		}
+	default:
+		return nil
+	}
+	if strings.TrimSpace(gql.Query) == "" {
+		return nil
+	}
+
+	doc := strings.TrimSpace(stripGraphQLComments(gql.Query))
+	switch m := graphQLOperation.FindStringSubmatch(doc); {
+	case strings.HasPrefix(doc, "{"):
+		// An anonymous query written as a bare selection set
+		gql.OperationType = "query"
+	case m != nil:
+		gql.OperationType = m[1]
+		if gql.OperationName == "" {
+			gql.OperationName = m[2]
+		}
+	default:
+		// Not a document, so likely a JSON API that happens to have a query field
+		return nil
+	}
+	return &gql
+}
+
+// stripGraphQLComments removes # comments, which run to the end of the line
+func stripGraphQLComments(doc string) string {
+	lines := strings.Split(doc, "\n")
+	for i, line := range lines {
+		if j := strings.IndexByte(line, '#'); j >= 0 {
+			lines[i] = line[:j]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+)
+
+// HAR 1.2 types, covering the subset webhook-host can fill in. The
+// enclosing log object is written by streamExportHandler.
+// See http://www.softwareishard.com/blog/har-12-spec/
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	ID              int         `json:"_id"`
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	// Encoding is "base64" for binary bodies, mirroring HAR's content.encoding
+	Encoding string `json:"_encoding,omitempty"`
+	// Params are the parsed fields of a form body
+	Params []harNameValue `json:"params,omitempty"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// newHAREntry converts a capture into a HAR entry. Captures store only the path,
+// so base supplies the scheme and host. webhook-host doesn't record the
+// reply it sent, so the response is rebuilt from the stored status and the
+// fixed acknowledgement body.
+func newHAREntry(info RequestInfo, base string) harEntry {
+	proto := info.Proto
+	if proto == "" {
+		// Captured before the protocol was recorded
+		proto = "HTTP/1.1"
+	}
+	req := harRequest{
+		Method:      info.Method,
+		URL:         base + info.URL,
+		HTTPVersion: proto,
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(info.Headers),
+		QueryString: []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    info.BodySize,
+	}
+	for k, vs := range requestQuery(info) {
+		for _, v := range vs {
+			req.QueryString = append(req.QueryString, harNameValue{Name: k, Value: v})
+		}
+	}
+	sort.SliceStable(req.QueryString, func(i, j int) bool { return req.QueryString[i].Name < req.QueryString[j].Name })
+	for _, c := range info.Cookies {
+		req.Cookies = append(req.Cookies, harNameValue{Name: c.Name, Value: c.Value})
+	}
+	if info.Body != "" {
+		req.PostData = &harPostData{MimeType: info.Headers.Get("Content-Type"), Text: info.Body, Encoding: info.BodyEncoding}
+		if len(info.Form) > 0 {
+			req.PostData.Params = harHeaders(Header(info.Form))
+		}
+	}
+
+	status := info.Status
+	if status == 0 {
+		// Captured before the status was recorded
+		status = http.StatusOK
+	}
+	reply := builtinReply
+	if info.Reply != nil {
+		reply = *info.Reply
+	}
+	if reply.Echo {
+		reply.Body = info.Body
+	}
+	headers := []harNameValue{{Name: "Content-Type", Value: reply.contentType()}}
+	for _, k := range slices.Sorted(maps.Keys(reply.Headers)) {
+		if http.CanonicalHeaderKey(k) != "Content-Type" {
+			headers = append(headers, harNameValue{Name: http.CanonicalHeaderKey(k), Value: reply.Headers[k]})
+		}
+	}
+	return harEntry{
+		ID:              info.ID,
+		StartedDateTime: info.Timestamp,
+		Request:         req,
+		Response: harResponse{
+			Status:      status,
+			StatusText:  http.StatusText(status),
+			HTTPVersion: proto,
+			Cookies:     []harNameValue{},
+			Headers:     headers,
+			Content:     harContent{Size: len(reply.Body), MimeType: reply.contentType(), Text: reply.Body},
+			HeadersSize: -1,
+			BodySize:    len(reply.Body),
+		},
+		Comment: info.Notes,
+	}
+}
+
+// harHeaders flattens a header map into HAR name/value pairs, one per value,
+// sorted by name
+func harHeaders(headers Header) []harNameValue {
+	out := make([]harNameValue, 0, len(headers))
+	for k, values := range headers {
+		for _, v := range values {
+			out = append(out, harNameValue{Name: k, Value: v})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// requestBase returns the scheme and host r arrived on, used to turn stored
+// paths back into absolute URLs
+func requestBase(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+)
+
+// hubBuffer is how many events a subscriber may fall behind by before it
+// starts missing them
+const hubBuffer = 64
+
+// captureEvent is a change to the stored history. "request", "update" and
+// "delete" events carry the ID, and the first two the request itself;
+// "clear" carries neither.
+type captureEvent struct {
+	Type    string       `json:"type"`
+	ID      int          `json:"id,omitempty"`
+	Request *RequestInfo `json:"request,omitempty"`
+}
+
+// captureHub broadcasts store changes to in-process subscribers such as
+// long-polling and streaming clients. A slow subscriber misses events rather
+// than delaying the webhook response.
+type captureHub struct {
+	mu   sync.Mutex
+	subs map[chan captureEvent]struct{}
+}
+
+var captures = &captureHub{subs: make(map[chan captureEvent]struct{})}
+
+// subscribe returns a channel receiving every event published from now on.
+// Pass it to unsubscribe when done.
+func (h *captureHub) subscribe() chan captureEvent {
+	ch := make(chan captureEvent, hubBuffer)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *captureHub) unsubscribe(ch chan captureEvent) {
+	h.mu.Lock()
+	delete(h.subs, ch)
+	h.mu.Unlock()
+}
+
+func (h *captureHub) publish(ev captureEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// eventStore broadcasts every change made through it. It wraps the whole
+// decorator chain, so events carry full bodies, and sees changes from
+// retention, imports and restores as well as the API.
+type eventStore struct {
+	Store
+}
+
+func (s *eventStore) Add(info *RequestInfo) error {
+	if err := s.Store.Add(info); err != nil {
+		return err
+	}
+	published := *info
+	broadcast(captureEvent{Type: "request", ID: info.ID, Request: &published})
+	return nil
+}
+
+func (s *eventStore) Update(id int, fn func(*RequestInfo)) error {
+	var before, after RequestInfo
+	err := s.Store.Update(id, func(info *RequestInfo) {
+		before = *info
+		fn(info)
+		after = *info
+	})
+	if err != nil {
+		return err
+	}
+	// Filling in how long the capture took is bookkeeping; subscribers
+	// already had the capture from its "request" event
+	before.Timing = after.Timing
+	if reflect.DeepEqual(before, after) {
+		return nil
+	}
+	ev := captureEvent{Type: "update", ID: id}
+	if info, err := s.Store.Get(id); err == nil {
+		ev.Request = &info
+	}
+	broadcast(ev)
+	return nil
+}
+
+func (s *eventStore) Delete(id int) error {
+	if err := s.Store.Delete(id); err != nil {
+		return err
+	}
+	broadcast(captureEvent{Type: "delete", ID: id})
+	return nil
+}
+
+func (s *eventStore) Clear() error {
+	if err := s.Store.Clear(); err != nil {
+		return err
+	}
+	broadcast(captureEvent{Type: "clear"})
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// drain collects the events that arrive on ch until it's quiet
+func drain(ch chan captureEvent) []captureEvent {
+	var evs []captureEvent
+	for {
+		select {
+		case ev := <-ch:
+			evs = append(evs, ev)
+		case <-time.After(100 * time.Millisecond):
+			return evs
+		}
+	}
+}
+
+func TestWebhookBroadcastsOnce(t *testing.T) {
+	srv := newTestServer(t)
+	ch := captures.subscribe()
+	defer captures.unsubscribe(ch)
+	send(t, srv, "POST", "/hook", "x")
+	evs := drain(ch)
+	if len(evs) != 1 || evs[0].Type != "request" {
+		t.Fatalf("a webhook broadcast %v, want one request event", evs)
+	}
+	id := evs[0].ID
+	info, err := store.Get(id)
+	if err != nil || info.Timing == nil || info.Timing.Total == 0 {
+		t.Errorf("stored timing %+v, %v", info.Timing, err)
+	}
+
+	store.Update(id, func(info *RequestInfo) { info.Pinned = true })
+	if evs := drain(ch); len(evs) != 1 || evs[0].Type != "update" || !evs[0].Request.Pinned {
+		t.Errorf("pinning broadcast %v, want one update event", evs)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// JWT is the decoded, unverified header and claims of a bearer token
+type JWT struct {
+	Header map[string]any `json:"header"`
+	Claims map[string]any `json:"claims"`
+	// Expired is set when the exp claim had passed as the request arrived
+	Expired bool `json:"expired,omitempty"`
+}
+
+// requestJWT decodes the JWT in an "Authorization: Bearer" header, or
+// returns nil when there isn't one. The signature isn't checked; this is
+// for looking at what a sender put in its token.
+func requestJWT(authorization string, at time.Time) *JWT {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil
+	}
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	var jwt JWT
+	if !decodeJWTPart(parts[0], &jwt.Header) || !decodeJWTPart(parts[1], &jwt.Claims) {
+		return nil
+	}
+	if exp, ok := jwt.Claims["exp"].(json.Number); ok {
+		if secs, err := exp.Float64(); err == nil {
+			jwt.Expired = at.After(time.Unix(int64(secs), 0))
+		}
+	}
+	return &jwt
+}
+
+// decodeJWTPart decodes one base64url JSON object segment of a token into
+// v, keeping numbers exact
+func decodeJWTPart(part string, v *map[string]any) bool {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(part, "="))
+	if err != nil {
+		return false
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v) == nil && *v != nil
+}
@@ -1,55 +1,233 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"sync"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
-// RequestInfo holds details about a captured HTTP request
-type RequestInfo struct {
-	ID         int               `json:"id"`
-	Method     string            `json:"method"`
-	URL        string            `json:"url"`
-	Headers    map[string]string `json:"headers"`
-	Body       string            `json:"body"`
-	Timestamp  time.Time         `json:"timestamp"`
-	RemoteAddr string            `json:"remote_addr"`
-}
+// maxBodySize caps the webhook bodies read, set by --max-body-size; 0 means
+// no limit
+var maxBodySize int64
+
+// webhookReply is the body captured webhooks are answered with by default
+const webhookReply = "Webhook received"
 
 var (
-	requests []RequestInfo
-	mu       sync.RWMutex
-	nextID   = 1
+	store     Store
+	retention Retention
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "tail" {
+		runTail(os.Args[2:])
+		return
+	}
+	cfg := loadConfig()
+
+	var err error
+	store, err = openStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open %s store: %v", cfg.Store, err)
+	}
+	defer store.Close()
+
+	if cfg.EventsRedis != "" {
+		if fanout, err = newRedisEvents(cfg.EventsRedis, cfg.RedisPrefix+"events"); err != nil {
+			log.Fatalf("Failed to subscribe to events: %v", err)
+		}
+	}
+
+	retention = cfg.Retention
+	if cfg.ArchiveURL != "" {
+		if retention.Archiver, err = newBucketArchiver(cfg.ArchiveURL, cfg.ArchiveEndpoint); err != nil {
+			log.Fatalf("Failed to set up archive: %v", err)
+		}
+	}
+	go runJanitor(store, retention, cfg.PruneInterval)
+	if cfg.PurgeCron != "" {
+		if err := schedulePurge(store, cfg.PurgeCron, cfg.PurgeWindow, retention.Archiver); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if cfg.ElasticURL != "" {
+		addSink("elasticsearch", newElasticSink(cfg.ElasticURL, cfg.ElasticIndex, cfg.ElasticAPIKey))
+	}
+
+	if cfg.ClickHouseURL != "" {
+		ch, err := newClickHouseSink(cfg.ClickHouseURL, cfg.ClickHouseTable)
+		if err != nil {
+			log.Fatalf("Failed to set up ClickHouse: %v", err)
+		}
+		addSink("clickhouse", ch)
+	}
+
+	if cfg.CaptureLog != "" {
+		jl, err := newJSONLSink(cfg.CaptureLog, int64(cfg.CaptureLogMaxSize), cfg.CaptureLogDaily, cfg.CaptureLogKeep)
+		if err != nil {
+			log.Fatalf("Failed to open capture log: %v", err)
+		}
+		addSink("capture-log", jl)
+	}
+
+	if cfg.NotifyExec != "" {
+		filter, err := parseNotifyFilter(cfg.NotifyExecFilter)
+		if err != nil {
+			log.Fatalf("Invalid --notify-exec-filter: %v", err)
+		}
+		filter.allBins = true
+		addNotifier("exec", newExecNotifier(cfg.NotifyExec), filter)
+	}
+	if err := loadNotifications(cfg.NotificationsFile); err != nil {
+		log.Fatalf("Failed to load notifications: %v", err)
+	}
+	if err := loadBins(cfg.BinsFile, cfg.BinTTL); err != nil {
+		log.Fatalf("Failed to load bins: %v", err)
+	}
+	if err := loadRules(cfg.RulesFile); err != nil {
+		log.Fatalf("Failed to load rules: %v", err)
+	}
+	if err := loadUsers(cfg.UsersFile, cfg.Signup); err != nil {
+		log.Fatalf("Failed to load users: %v", err)
+	}
+	if err := initSessionKey(cfg.SessionKey); err != nil {
+		log.Fatalf("Failed to create session key: %v", err)
+	}
+	if anonymousRole, err = parseRole(cfg.AnonymousRole); err != nil {
+		log.Fatalf("Invalid --anonymous-role: %v", err)
+	}
+	if defaultRole, err = parseRole(cfg.DefaultRole); err != nil {
+		log.Fatalf("Invalid --default-role: %v", err)
+	}
+	if cfg.AdminUser != "" {
+		if err := users.bootstrapAdmin(cfg.AdminUser, cfg.AdminPassword); err != nil {
+			log.Fatalf("Failed to set up --admin-user: %v", err)
+		}
+	}
+	if err := loadAudit(cfg.AuditLog); err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	publicURL = cfg.PublicURL
+	if cfg.GitHubClientID != "" {
+		oauthProviders["github"] = newGitHubProvider(cfg.GitHubClientID, cfg.GitHubClientSecret)
+	}
+	if cfg.GoogleClientID != "" {
+		oauthProviders["google"] = newGoogleProvider(cfg.GoogleClientID, cfg.GoogleClientSecret)
+	}
+	if cfg.OIDCIssuer != "" {
+		p, err := discoverOIDC(context.Background(), cfg.OIDCIssuer, cfg.OIDCClientID, cfg.OIDCClientSecret)
+		if err != nil {
+			log.Fatalf("Failed to discover --oidc-issuer: %v", err)
+		}
+		oauthProviders["oidc"] = p
+	}
+	for _, d := range strings.Split(cfg.OAuthAllowedDomains, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			oauthAllowedDomains = append(oauthAllowedDomains, d)
+		}
+	}
+
 	// Serve static files for the UI
 	fs := http.FileServer(http.Dir("./static"))
 	http.Handle("/ui/", http.StripPrefix("/ui/", fs))
 
-	// API endpoint to get requests
-	http.HandleFunc("/api/requests", getRequestsHandler)
-
-	// API endpoint to clear requests
-	http.HandleFunc("/api/clear", clearRequestsHandler)
+	// Management API, described at /api/v1/openapi.json
+	adminToken = cfg.AdminToken
+	registerAPI(http.DefaultServeMux)
 
-	// Catch-all handler for webhooks
+	// Catch-all handler for webhooks, and for those sent to a bin
 	http.HandleFunc("/", webhookHandler)
+	http.HandleFunc("/b/{token}", webhookHandler)
+	http.HandleFunc("/b/{token}/", webhookHandler)
+	http.HandleFunc("/echo", echoHandler)
+	http.HandleFunc("/echo/", echoHandler)
+
+	addr := ":" + cfg.Port
+	binDomain = strings.ToLower(strings.Trim(cfg.BinDomain, "."))
+	srv := newServer(addr, routeBinHosts(compressResponses(http.DefaultServeMux)))
+	scheme := "http"
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		// Load the pair now so a bad certificate stops startup, even in TUI mode
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		fingerprintClients(srv)
+		if cfg.ClientCA != "" {
+			if srv.TLSConfig.ClientCAs, err = loadCertPool(cfg.ClientCA); err != nil {
+				log.Fatalf("Failed to load --tls-client-ca: %v", err)
+			}
+		}
+		if srv.TLSConfig.ClientAuth, err = clientAuthType(cfg.ClientAuth, cfg.ClientCA != ""); err != nil {
+			log.Fatalf("Invalid --tls-client-auth: %v", err)
+		}
+		scheme = "https"
+	}
+	serve := func(ln net.Listener) error {
+		if srv.TLSConfig != nil {
+			return srv.ServeTLS(ln, "", "")
+		}
+		return srv.Serve(ln)
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Listen first so a busy port is reported before the TUI takes over
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
 	}
-	addr := ":" + port
-	fmt.Printf("Server started on http://localhost%s\n", addr)
-	fmt.Printf("UI available at http://localhost%s/ui/\n", addr)
-	log.Fatal(http.ListenAndServe(addr, nil))
+	rawDump = cfg.RawDump
+	maxBodySize = int64(cfg.MaxBodySize)
+	binRateLimit, binMaxStorage = cfg.BinRateLimit, int64(cfg.BinMaxStorage)
+	if defaultReply, err = parseDefaultReply(cfg.ResponseStatus, cfg.ResponseContentType, cfg.ResponseHeaders.headers, cfg.ResponseBody, cfg.ResponseTemplate, cfg.Echo); err != nil {
+		log.Fatalf("Invalid default response: %v", err)
+	}
+	for _, name := range strings.Split(cfg.EchoHeaders, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			echoHeaders = append(echoHeaders, name)
+		}
+	}
+	if trustedProxies, err = parseTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid --trusted-proxies: %v", err)
+	}
+	if err := openGeoDBs(cfg.GeoIPDB); err != nil {
+		log.Fatalf("Failed to open --geoip-db: %v", err)
+	}
+	if err := loadProtoDescriptors(cfg.ProtoDescs, cfg.ProtoMessages); err != nil {
+		log.Fatalf("Failed to load protobuf descriptors: %v", err)
+	}
+	if redactions, err = parseRedactions(cfg.Redact); err != nil {
+		log.Fatalf("Invalid --redact: %v", err)
+	}
+	if cfg.ReverseDNS > 0 {
+		hostnames = newHostnameCache(cfg.ReverseDNS)
+	}
+	if rawDump && srv.TLSConfig == nil {
+		// Over HTTPS net/http needs the *tls.Conn itself, so dumps there are
+		// rebuilt instead
+		ln = recordingListener{ln}
+	}
+	if cfg.TUI {
+		go serve(ln)
+		if err := runTUI(store, scheme+"://localhost"+addr); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	fmt.Printf("Server started on %s://localhost%s\n", scheme, addr)
+	fmt.Printf("UI available at %s://localhost%s/ui/\n", scheme, addr)
+	log.Fatal(serve(ln))
 }
 
 func webhookHandler(w http.ResponseWriter, r *http.Request) {
@@ -57,56 +235,225 @@ func webhookHandler(w http.ResponseWriter, r *http.Request) {
 	// But since "/" matches everything, we don't strictly need this if we trust ServeMux.
 	// However, let's be safe.
 
+	start := time.Now()
+	bin := bins.get(r.PathValue("token"))
+	if bin.expired(start) {
+		http.Error(w, "Bin expired", http.StatusNotFound)
+		return
+	}
+	rate, storage := bin.limits()
+	if wait, ok := takeRequest(r.PathValue("token"), rate, start); !ok {
+		w.Header().Set("Retry-After", retryAfter(wait))
+		http.Error(w, fmt.Sprintf("Rate limit of %d requests a minute reached", rate), http.StatusTooManyRequests)
+		return
+	}
+	limit := maxBodySize
+	if bin.MaxBodySize > 0 {
+		limit = bin.MaxBodySize
+	}
+	if limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
 	bodyBytes, err := io.ReadAll(r.Body)
-	if err != nil {
+	var tooLarge *http.MaxBytesError
+	truncated := errors.As(err, &tooLarge)
+	if err != nil && !truncated {
 		http.Error(w, "Failed to read body", http.StatusInternalServerError)
 		return
 	}
 	defer r.Body.Close()
-
-	headers := make(map[string]string)
-	for k, v := range r.Header {
-		headers[k] = v[0] // Just taking the first value for simplicity
+	readBody := millis(time.Since(start))
+	if storage > 0 && storageUsed(store, r.PathValue("token"))+int64(len(bodyBytes)) > storage {
+		http.Error(w, fmt.Sprintf("Storage quota of %d bytes used up; delete captures to make room", storage), http.StatusTooManyRequests)
+		return
 	}
 
-	info := RequestInfo{
-		Method:     r.Method,
-		URL:        r.URL.String(),
-		Headers:    headers,
-		Body:       string(bodyBytes),
-		Timestamp:  time.Now(),
-		RemoteAddr: r.RemoteAddr,
+	info := newRequestInfo(r, bodyBytes)
+	info.Bin = r.PathValue("token")
+	rep := replyFor(bin)
+	rule, captures, matched := rules.match(r, info.Bin, pathInBin(r, info.Bin))
+	if matched {
+		rep, info.Rule = rule.Response, rule.ID
+		if len(captures) > 0 {
+			info.RuleGroups = captures
+		}
+	}
+	reply, err := rep.render(info)
+	if err != nil {
+		log.Printf("Failed to render response template: %v", err)
+		reply = Reply{Status: http.StatusInternalServerError, Body: "Failed to render response template: " + err.Error()}
+	}
+	if reply.Echo || echoRequested(r) {
+		reply = reply.echo(r, bodyBytes)
+	}
+	info.Status = reply.status()
+	if !reply.builtin() {
+		recorded := reply.recorded()
+		info.Reply = &recorded
+	}
+	if truncated {
+		// Keep what fit, so the sender can still be identified
+		info.Truncated, info.Status = true, http.StatusRequestEntityTooLarge
+	}
+	info.ExpiresAt = retention.expiry(r, info.Timestamp)
+	info.Timing = &Timing{ReadBody: readBody}
+	// A hostname seen recently is filled in now; otherwise it's looked up
+	// once the capture is stored, so slow DNS never delays the reply
+	hostKnown := true
+	if hostnames != nil {
+		info.Hostname, hostKnown = hostnames.cached(senderIP(info))
+	}
+	stored := time.Now()
+	if err := store.Add(&info); err != nil {
+		log.Printf("Failed to store request: %v", err)
+		http.Error(w, "Failed to store request", http.StatusInternalServerError)
+		return
+	}
+	// The write's own duration is only known once it's done. Published
+	// copies share the first Timing, so it's replaced rather than changed.
+	timing := Timing{ReadBody: readBody, Store: millis(time.Since(stored)), Total: millis(time.Since(start))}
+	if err := store.Update(info.ID, func(i *RequestInfo) { i.Timing = &timing }); err != nil {
+		log.Printf("Failed to record timing: %v", err)
+	}
+	info.Timing = &timing
+	if !hostKnown {
+		hostnames.resolve(info.ID, senderIP(info))
+	}
+	publishToSinks(info)
+	// Don't notify about our own notifications, so a hook pointed back at
+	// this instance can't loop
+	if r.Header.Get(notificationHeader) == "" {
+		notify(info)
 	}
 
-	mu.Lock()
-	info.ID = nextID
-	nextID++
-	// Prepend to show newest first
-	requests = append([]RequestInfo{info}, requests...)
-	// Keep only last 100 requests to avoid memory issues
-	if len(requests) > 100 {
-		requests = requests[:100]
+	// Enforce the count and memory caps straight away rather than waiting for the janitor
+	if retention.overLimit(store, info.Bin) {
+		retention.pruneSoon(store)
 	}
-	mu.Unlock()
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Webhook received")
+	if truncated {
+		http.Error(w, fmt.Sprintf("Request body larger than %d bytes", limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if matched {
+		holdReply(r, time.Duration(rule.Delay))
+	}
+	reply.write(w)
 }
 
 func getRequestsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	mu.RLock()
-	defer mu.RUnlock()
-	json.NewEncoder(w).Encode(requests)
+	list, pg, ok := filteredRequests(w, r)
+	if !ok {
+		return
+	}
+	writeRequestPage(w, r, list, pg)
 }
 
+// filteredRequests loads the requests matching r's filter parameters along
+// with its page window, writing an error response and returning false on
+// failure
+func filteredRequests(w http.ResponseWriter, r *http.Request) ([]RequestInfo, page, bool) {
+	pg, err := parsePage(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, pg, false
+	}
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, pg, false
+	}
+	list, err := listRequests(filter)
+	if err != nil {
+		http.Error(w, "Failed to list requests", http.StatusInternalServerError)
+		return nil, pg, false
+	}
+	countSeen(list)
+	return filter.apply(list), pg, true
+}
+
+// listRequests loads the stored requests f could match. With a since_id only
+// the newer captures are read; Seen counts then cover just those.
+func listRequests(f Filter) ([]RequestInfo, error) {
+	if f.SinceID == 0 {
+		return store.List()
+	}
+	// IDs only grow, so a newest-first read can stop at the first old one
+	list := []RequestInfo{}
+	err := store.Each(func(info RequestInfo) error {
+		if info.ID <= f.SinceID {
+			return errStopEach
+		}
+		list = append(list, info)
+		return nil
+	})
+	if errors.Is(err, errStopEach) {
+		err = nil
+	}
+	return list, err
+}
+
+// writeRequestPage writes one page of list as JSON in the requested sort
+// order, with the unpaged length in X-Total-Count
+func writeRequestPage(w http.ResponseWriter, r *http.Request, list []RequestInfo, pg page) {
+	order, err := parseSort(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	order.apply(list)
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(list)))
+	list = pg.apply(list)
+	// Spilled bodies are only previews in the list unless asked for in full
+	if r.URL.Query().Get("full") == "true" {
+		if err := hydrateBodies(list); err != nil {
+			http.Error(w, "Failed to load request body", http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSONWithETag(w, r, list)
+}
+
+// clearRequestsHandler removes every request except pinned ones, which go
+// too with ?include_pinned=true. ?bin= limits it to one bin.
 func clearRequestsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	mu.Lock()
-	requests = []RequestInfo{}
-	mu.Unlock()
+	if err := clearRequests(r.URL.Query().Get("include_pinned") == "true", r.URL.Query().Get("bin")); err != nil {
+		http.Error(w, "Failed to clear requests", http.StatusInternalServerError)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
+
+// clearRequests empties the store, or just bin when it isn't "". Clearing
+// everything still leaves bins protected by a read token alone.
+func clearRequests(includePinned bool, bin string) error {
+	list, err := store.List()
+	if err != nil {
+		return err
+	}
+	keep := func(info RequestInfo) bool {
+		if info.Pinned && !includePinned {
+			return true
+		}
+		if bin != "" {
+			return info.Bin != bin
+		}
+		return bins.protected(info.Bin)
+	}
+	if !slices.ContainsFunc(list, keep) {
+		return store.Clear()
+	}
+	for _, info := range list {
+		if keep(info) {
+			continue
+		}
+		if err := store.Delete(info.ID); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// FilePart describes one uploaded file in a multipart/form-data body. The
+// content stays in the body and is served by requestFileHandler.
+type FilePart struct {
+	Field       string `json:"field"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int    `json:"size"`
+}
+
+// errNoFile is returned by multipartFile when the body has fewer file parts
+// than asked for
+var errNoFile = errors.New("file not found")
+
+// multipartReader returns a reader over body when contentType is
+// multipart/form-data with a boundary, or nil
+func multipartReader(contentType string, body []byte) *multipart.Reader {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return nil
+	}
+	return multipart.NewReader(bytes.NewReader(body), params["boundary"])
+}
+
+// parseForm returns the fields of an application/x-www-form-urlencoded or
+// multipart/form-data body, and a multipart body's file parts
+func parseForm(contentType string, body []byte) (url.Values, []FilePart) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "application/x-www-form-urlencoded" {
+		return parseMultipart(contentType, body)
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil || len(form) == 0 {
+		return nil, nil
+	}
+	return form, nil
+}
+
+// parseMultipart splits a multipart/form-data body into its form fields and
+// file parts. Other bodies, and malformed ones, give nil for both, leaving
+// the capture with only its raw body.
+func parseMultipart(contentType string, body []byte) (url.Values, []FilePart) {
+	mr := multipartReader(contentType, body)
+	if mr == nil {
+		return nil, nil
+	}
+	form := url.Values{}
+	var files []FilePart
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, nil
+		}
+		if part.FileName() != "" {
+			files = append(files, FilePart{
+				Field:       part.FormName(),
+				Filename:    part.FileName(),
+				ContentType: part.Header.Get("Content-Type"),
+				Size:        len(data),
+			})
+			continue
+		}
+		form.Add(part.FormName(), string(data))
+	}
+	if len(form) == 0 {
+		form = nil
+	}
+	return form, files
+}
+
+// multipartFile returns the content of the nth file part of body
+func multipartFile(contentType string, body []byte, n int) ([]byte, error) {
+	mr := multipartReader(contentType, body)
+	if mr == nil {
+		return nil, errNoFile
+	}
+	for i := 0; ; {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, errNoFile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		if i == n {
+			return io.ReadAll(part)
+		}
+		i++
+	}
+}
+
+// requestFileHandler downloads one uploaded file from a multipart capture,
+// numbered from 0 in the order of its files list
+func requestFileHandler(w http.ResponseWriter, r *http.Request) {
+	info, ok := requestFromPath(w, r)
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || n < 0 || n >= len(info.Files) {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	body, err := info.rawBody()
+	if err != nil {
+		http.Error(w, "Failed to decode body", http.StatusInternalServerError)
+		return
+	}
+	data, err := multipartFile(info.Headers.Get("Content-Type"), body, n)
+	if errors.Is(err, errNoFile) {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	writeDownload(w, info.Files[n].ContentType, info.Files[n].Filename, data)
+}
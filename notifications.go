@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// notificationHook is a registered URL that is POSTed a summary of every
+// capture matching Filter, written as list query parameters
+type notificationHook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Filter    string    `json:"filter,omitempty"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// notificationRegistry holds the registered hooks, each with its own
+// notifier queue, and keeps them in a JSON file when a path is set
+type notificationRegistry struct {
+	mu     sync.Mutex
+	path   string
+	nextID int
+	hooks  []notificationHook
+	queues map[int]*notifierQueue
+}
+
+var notifications = &notificationRegistry{nextID: 1, queues: map[int]*notifierQueue{}}
+
+// loadNotifications reads the hooks saved at path, if any, and starts
+// delivering to them. An empty path keeps hooks in memory only.
+func loadNotifications(path string) error {
+	r := notifications
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.path = path
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &r.hooks); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, h := range r.hooks {
+		if err := r.start(h); err != nil {
+			return fmt.Errorf("notification %d: %w", h.ID, err)
+		}
+		r.nextID = max(r.nextID, h.ID+1)
+	}
+	return nil
+}
+
+// start registers h's notifier; callers hold r.mu
+func (r *notificationRegistry) start(h notificationHook) error {
+	filter, err := parseNotifyFilter(h.Filter)
+	if err != nil {
+		return err
+	}
+	r.queues[h.ID] = addNotifier("notification "+strconv.Itoa(h.ID), newHTTPNotifier(h.ID, h.URL, h.Secret), filter)
+	return nil
+}
+
+// save writes the hooks to r.path; callers hold r.mu
+func (r *notificationRegistry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.hooks, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+func (r *notificationRegistry) add(h notificationHook) (notificationHook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h.ID = r.nextID
+	h.CreatedAt = time.Now()
+	if err := r.start(h); err != nil {
+		return h, err
+	}
+	r.nextID++
+	r.hooks = append(r.hooks, h)
+	return h, r.save()
+}
+
+func (r *notificationRegistry) remove(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.hooks, func(h notificationHook) bool { return h.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	removeNotifier(r.queues[id])
+	delete(r.queues, id)
+	r.hooks = slices.Delete(r.hooks, i, i+1)
+	return r.save()
+}
+
+// list returns the hooks with their secrets blanked
+func (r *notificationRegistry) list() []notificationHook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]notificationHook, len(r.hooks))
+	for i, h := range r.hooks {
+		out[i] = h.redacted()
+	}
+	return out
+}
+
+func (r *notificationRegistry) get(id int) (notificationHook, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.hooks, func(h notificationHook) bool { return h.ID == id })
+	if i < 0 {
+		return notificationHook{}, false
+	}
+	return r.hooks[i], true
+}
+
+// readableBy reports whether r may see and remove h: it must be able to read
+// the bin h's filter is scoped to, and only that bin when it holds no more
+// than the bin's credentials
+func (h notificationHook) readableBy(r *http.Request) bool {
+	filter, err := parseNotifyFilter(h.Filter)
+	if err != nil {
+		return false
+	}
+	return canReadBin(r, filter.Bin) && inScope(r, filter.Bin)
+}
+
+func (h notificationHook) redacted() notificationHook {
+	if h.Secret != "" {
+		h.Secret = "********"
+	}
+	return h
+}
+
+// listNotificationsHandler returns the hooks r may see
+func listNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	list := []notificationHook{}
+	for _, h := range notifications.list() {
+		if h.readableBy(r) {
+			list = append(list, h)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// notificationInput is the body accepted when registering a hook
+type notificationInput struct {
+	URL    string `json:"url"`
+	Filter string `json:"filter"`
+	Secret string `json:"secret"`
+}
+
+// createNotificationHandler registers a hook from a body such as
+// {"url": "https://example.com/hook", "filter": "path=/stripe"}. With a
+// secret, each POST is signed in X-Webhook-Host-Signature.
+func createNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	var in notificationInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	u, err := url.Parse(in.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "Invalid url; use an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+	filter, err := parseNotifyFilter(in.Filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !canReadBin(r, filter.Bin) || !inScope(r, filter.Bin) {
+		binUnauthorized(w, filter.Bin)
+		return
+	}
+	h, err := notifications.add(notificationHook{URL: in.URL, Filter: in.Filter, Secret: in.Secret})
+	if err != nil {
+		http.Error(w, "Failed to save notification", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(h.redacted())
+}
+
+func deleteNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+		return
+	}
+	if h, ok := notifications.get(id); ok && !h.readableBy(r) {
+		http.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+	err = notifications.remove(id)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to save notifications", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Notifier is told about each capture matching its filter, one at a time.
+// Integrations such as chat messages, email or local commands implement it
+// and share the delivery pipeline below, which runs off the request path
+// with a bounded queue, a timeout and retries.
+type Notifier interface {
+	Notify(ctx context.Context, info RequestInfo) error
+}
+
+const (
+	notifyQueueSize = 1000
+	notifyTimeout   = 10 * time.Second
+	notifyAttempts  = 3
+	// notifyBackoff is the wait before the first retry, doubling after
+	notifyBackoff = time.Second
+)
+
+type notifierQueue struct {
+	name   string
+	n      Notifier
+	filter Filter
+	ch     chan RequestInfo
+}
+
+var (
+	notifiersMu sync.RWMutex
+	notifiers   []*notifierQueue
+)
+
+// addNotifier registers n for the captures matching filter and starts its
+// delivery goroutine. Pass the result to removeNotifier to unregister it.
+func addNotifier(name string, n Notifier, filter Filter) *notifierQueue {
+	q := &notifierQueue{name: name, n: n, filter: filter, ch: make(chan RequestInfo, notifyQueueSize)}
+	notifiersMu.Lock()
+	notifiers = append(notifiers, q)
+	notifiersMu.Unlock()
+	go q.run()
+	return q
+}
+
+// removeNotifier unregisters q. Captures already queued are still delivered.
+func removeNotifier(q *notifierQueue) {
+	notifiersMu.Lock()
+	defer notifiersMu.Unlock()
+	if i := slices.Index(notifiers, q); i >= 0 {
+		notifiers = slices.Delete(notifiers, i, i+1)
+		close(q.ch)
+	}
+}
+
+// parseNotifyFilter reads a notifier filter written as list query
+// parameters, such as "method=POST&path=/stripe"; empty matches everything
+func parseNotifyFilter(s string) (Filter, error) {
+	q, err := url.ParseQuery(s)
+	if err != nil {
+		return Filter{}, fmt.Errorf("invalid filter %q: %w", s, err)
+	}
+	return parseFilter(q)
+}
+
+// notify queues info for every notifier whose filter it matches, dropping it
+// for notifiers whose queue is full rather than blocking the capture
+func notify(info RequestInfo) {
+	notifiersMu.RLock()
+	defer notifiersMu.RUnlock()
+	for _, q := range notifiers {
+		if !q.filter.Match(info) {
+			continue
+		}
+		select {
+		case q.ch <- info:
+		default:
+			log.Printf("Notifier %s queue full, dropping request %d", q.name, info.ID)
+		}
+	}
+}
+
+func (q *notifierQueue) run() {
+	for info := range q.ch {
+		backoff := notifyBackoff
+		var err error
+		for attempt := 1; attempt <= notifyAttempts; attempt++ {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			err = q.n.Notify(ctx, info)
+			cancel()
+			if err == nil {
+				break
+			}
+			if attempt < notifyAttempts {
+				time.Sleep(backoff)
+				backoff *= 2
+			}
+		}
+		if err != nil {
+			log.Printf("Notifier %s failed for request %d after %d attempts: %v", q.name, info.ID, notifyAttempts, err)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// execNotifier runs a shell command per capture. The capture is passed as
+// JSON on stdin, with the basics also in WEBHOOK_* environment variables for
+// one-liners.
+type execNotifier struct {
+	command string
+}
+
+func newExecNotifier(command string) *execNotifier {
+	return &execNotifier{command: command}
+}
+
+func (e *execNotifier) Notify(ctx context.Context, info RequestInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", e.command)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(),
+		"WEBHOOK_ID="+strconv.Itoa(info.ID),
+		"WEBHOOK_METHOD="+info.Method,
+		"WEBHOOK_URL="+info.URL,
+		"WEBHOOK_PATH="+requestPath(info),
+		"WEBHOOK_REMOTE_ADDR="+info.RemoteAddr,
+		"WEBHOOK_CLIENT_IP="+senderIP(info),
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
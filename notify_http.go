@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// notificationHeader marks webhook-host's own outbound notifications. Captures
+// carrying it don't notify again, so a notification URL pointing back at an
+// instance can't loop.
+const notificationHeader = "X-Webhook-Host-Notification"
+
+// signatureHeader carries the hex HMAC-SHA256 of the payload when the
+// notification has a secret
+const signatureHeader = "X-Webhook-Host-Signature"
+
+// notificationPayload is the summary POSTed for each matching capture. It
+// leaves out the body; fetch the request by ID for the rest.
+type notificationPayload struct {
+	Event   string              `json:"event"`
+	Request notificationSummary `json:"request"`
+}
+
+type notificationSummary struct {
+	ID          int       `json:"id"`
+	Method      string    `json:"method"`
+	URL         string    `json:"url"`
+	Path        string    `json:"path"`
+	RemoteAddr  string    `json:"remote_addr"`
+	ClientIP    string    `json:"client_ip,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+	ContentType string    `json:"content_type,omitempty"`
+	BodySize    int       `json:"body_size"`
+	Tags        []string  `json:"tags,omitempty"`
+	APIPath     string    `json:"api_path"`
+}
+
+// httpNotifier POSTs a notificationPayload to a URL
+type httpNotifier struct {
+	hookID int
+	url    string
+	secret string
+	client *http.Client
+}
+
+func newHTTPNotifier(hookID int, url, secret string) *httpNotifier {
+	return &httpNotifier{hookID: hookID, url: url, secret: secret, client: &http.Client{}}
+}
+
+func (n *httpNotifier) Notify(ctx context.Context, info RequestInfo) error {
+	payload, err := json.Marshal(notificationPayload{
+		Event: "request.captured",
+		Request: notificationSummary{
+			ID:          info.ID,
+			Method:      info.Method,
+			URL:         info.URL,
+			Path:        requestPath(info),
+			RemoteAddr:  info.RemoteAddr,
+			ClientIP:    info.ClientIP,
+			Timestamp:   info.Timestamp,
+			ContentType: info.Headers.Get("Content-Type"),
+			BodySize:    info.BodySize,
+			Tags:        info.Tags,
+			APIPath:     fmt.Sprintf("%s/requests/%d", apiPrefix, info.ID),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "webhook-host")
+	req.Header.Set(notificationHeader, strconv.Itoa(n.hookID))
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(payload)
+		req.Header.Set(signatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
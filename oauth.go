@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// oauthCookie carries the state of a login in flight with a provider
+const oauthCookie = "webhook_host_oauth"
+
+// oauthIdentity is who a provider says logged in
+type oauthIdentity struct {
+	Subject       string // the provider's stable ID for the account
+	Username      string
+	Email         string
+	EmailVerified bool
+}
+
+// oauthProvider is an OAuth 2 authorization server that users can log in
+// through, such as GitHub or an OIDC issuer
+type oauthProvider struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	Scopes       []string
+	// identity looks up who an access token belongs to
+	identity func(ctx context.Context, p *oauthProvider, accessToken string) (oauthIdentity, error)
+}
+
+// oauthProviders are the configured login providers by name
+var oauthProviders = map[string]*oauthProvider{}
+
+// oauthAllowedDomains, when set, limits login through a provider to accounts
+// with a verified email address at one of these domains
+var oauthAllowedDomains []string
+
+// publicURL is the scheme and host the server is reached at, from
+// --public-url, for redirect URLs behind a proxy
+var publicURL string
+
+var oauthClient = &http.Client{Timeout: 30 * time.Second}
+
+func newGitHubProvider(clientID, clientSecret string) *oauthProvider {
+	return &oauthProvider{
+		Name:         "github",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		AuthURL:      "https://github.com/login/oauth/authorize",
+		TokenURL:     "https://github.com/login/oauth/access_token",
+		Scopes:       []string{"read:user", "user:email"},
+		identity:     githubIdentity,
+	}
+}
+
+func newGoogleProvider(clientID, clientSecret string) *oauthProvider {
+	return &oauthProvider{
+		Name:         "google",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		AuthURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL:     "https://oauth2.googleapis.com/token",
+		Scopes:       []string{"openid", "email", "profile"},
+		identity:     userinfoIdentity("https://openidconnect.googleapis.com/v1/userinfo"),
+	}
+}
+
+// discoverOIDC configures a provider from the discovery document of issuer
+func discoverOIDC(ctx context.Context, issuer, clientID, clientSecret string) (*oauthProvider, error) {
+	var doc struct {
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	}
+	if err := oauthGet(ctx, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", "", &doc); err != nil {
+		return nil, err
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.UserinfoEndpoint == "" {
+		return nil, fmt.Errorf("%s: discovery document lacks an authorization, token or userinfo endpoint", issuer)
+	}
+	return &oauthProvider{
+		Name:         "oidc",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		AuthURL:      doc.AuthorizationEndpoint,
+		TokenURL:     doc.TokenEndpoint,
+		Scopes:       []string{"openid", "email", "profile"},
+		identity:     userinfoIdentity(doc.UserinfoEndpoint),
+	}, nil
+}
+
+// oauthGet fetches a JSON document into v, with token as a bearer token if set
+func oauthGet(ctx context.Context, url, token string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := oauthClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// githubIdentity reads the account and its primary email from the GitHub API
+func githubIdentity(ctx context.Context, p *oauthProvider, token string) (oauthIdentity, error) {
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+	}
+	if err := oauthGet(ctx, "https://api.github.com/user", token, &user); err != nil {
+		return oauthIdentity{}, err
+	}
+	type email struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	var emails []email
+	if err := oauthGet(ctx, "https://api.github.com/user/emails", token, &emails); err != nil {
+		return oauthIdentity{}, err
+	}
+	id := oauthIdentity{Subject: fmt.Sprint(user.ID), Username: user.Login}
+	if i := slices.IndexFunc(emails, func(e email) bool { return e.Primary }); i >= 0 {
+		id.Email, id.EmailVerified = emails[i].Email, emails[i].Verified
+	}
+	return id, nil
+}
+
+// userinfoIdentity reads the account from an OIDC userinfo endpoint. The ID
+// token is not needed: the access token came straight from the token
+// endpoint, so what userinfo says about it can be trusted.
+func userinfoIdentity(endpoint string) func(context.Context, *oauthProvider, string) (oauthIdentity, error) {
+	return func(ctx context.Context, p *oauthProvider, token string) (oauthIdentity, error) {
+		var info struct {
+			Subject           string `json:"sub"`
+			PreferredUsername string `json:"preferred_username"`
+			Email             string `json:"email"`
+			EmailVerified     any    `json:"email_verified"` // some issuers send "true"
+		}
+		if err := oauthGet(ctx, endpoint, token, &info); err != nil {
+			return oauthIdentity{}, err
+		}
+		if info.Subject == "" {
+			return oauthIdentity{}, errors.New("userinfo has no sub")
+		}
+		username := info.PreferredUsername
+		if username == "" {
+			username, _, _ = strings.Cut(info.Email, "@")
+		}
+		return oauthIdentity{
+			Subject:       info.Subject,
+			Username:      username,
+			Email:         info.Email,
+			EmailVerified: info.EmailVerified == true || info.EmailVerified == "true",
+		}, nil
+	}
+}
+
+// allowed reports whether id may log in under --oauth-allowed-domains
+func (id oauthIdentity) allowed() bool {
+	if len(oauthAllowedDomains) == 0 {
+		return true
+	}
+	_, domain, ok := strings.Cut(id.Email, "@")
+	return ok && id.EmailVerified && slices.ContainsFunc(oauthAllowedDomains, func(d string) bool {
+		return strings.EqualFold(d, domain)
+	})
+}
+
+// redirectURL is where p sends users back to after they log in
+func (p *oauthProvider) redirectURL(r *http.Request) string {
+	base := publicURL
+	if base == "" {
+		base = requestBase(r)
+	}
+	return strings.TrimSuffix(base, "/") + apiPrefix + "/oauth/" + p.Name + "/callback"
+}
+
+// exchange trades an authorization code for an access token
+func (p *oauthProvider) exchange(ctx context.Context, r *http.Request, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL(r)},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := oauthClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("token response: %w", err)
+	}
+	if tok.Error != "" {
+		return "", fmt.Errorf("%s: %s", tok.Error, tok.ErrorDescription)
+	}
+	if tok.AccessToken == "" {
+		return "", fmt.Errorf("token response: %s without an access token", resp.Status)
+	}
+	return tok.AccessToken, nil
+}
+
+// safeNext returns next if it is a path on this server, else the login page
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/ui/login.html"
+	}
+	return next
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// oauthProvidersHandler lists the providers the login page can offer
+func oauthProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for name := range oauthProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(names)
+}
+
+// oauthLoginHandler sends the browser to the provider to log in, with PKCE
+// and a state kept in a short-lived cookie
+func oauthLoginHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := oauthProviders[r.PathValue("provider")]
+	if !ok {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+	state, err := randomString()
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+	verifier, err := randomString()
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthCookie,
+		Value:    url.Values{"state": {state}, "verifier": {verifier}, "next": {safeNext(r.URL.Query().Get("next"))}}.Encode(),
+		Path:     apiPrefix + "/oauth/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.redirectURL(r)},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	http.Redirect(w, r, p.AuthURL+"?"+q.Encode(), http.StatusFound)
+}
+
+// oauthCallbackHandler finishes a login: it checks the state, looks up who
+// logged in, finds or creates their account and starts a session
+func oauthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := oauthProviders[r.PathValue("provider")]
+	if !ok {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		http.Error(w, "Login failed: "+e, http.StatusUnauthorized)
+		return
+	}
+	c, err := r.Cookie(oauthCookie)
+	if err != nil {
+		http.Error(w, "Login expired; try again", http.StatusBadRequest)
+		return
+	}
+	flow, err := url.ParseQuery(c.Value)
+	if err != nil || flow.Get("state") == "" || flow.Get("state") != q.Get("state") {
+		http.Error(w, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oauthCookie, Path: apiPrefix + "/oauth/", MaxAge: -1, HttpOnly: true})
+
+	token, err := p.exchange(r.Context(), r, q.Get("code"), flow.Get("verifier"))
+	if err != nil {
+		http.Error(w, "Failed to exchange login code: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	id, err := p.identity(r.Context(), p, token)
+	if err != nil {
+		http.Error(w, "Failed to look up account: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	if !id.allowed() {
+		http.Error(w, "Account not allowed on this server", http.StatusForbidden)
+		return
+	}
+	u, err := users.external(p.Name, id.Subject, id.Username)
+	if err != nil {
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+	startSession(w, r, u.ID)
+	http.Redirect(w, r, safeNext(flow.Get("next")), http.StatusFound)
+}
+
+// usernameUnsafe matches what usernamePattern doesn't allow
+var usernameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// external returns the account linked to subject at provider, creating one
+// named after username, made unique, on first login
+func (r *userRegistry) external(provider, subject, username string) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if i := slices.IndexFunc(r.users, func(u User) bool { return u.Provider == provider && u.Subject == subject }); i >= 0 {
+		return r.users[i], nil
+	}
+	base := usernameUnsafe.ReplaceAllString(username, "-")
+	if base == "" {
+		base = provider
+	}
+	base = base[:min(len(base), 56)]
+	name := base
+	for n := 2; slices.ContainsFunc(r.users, func(u User) bool { return strings.EqualFold(u.Username, name) }); n++ {
+		name = fmt.Sprintf("%s-%d", base, n)
+	}
+	u := User{ID: r.nextID, Username: name, Provider: provider, Subject: subject, Role: defaultRole, CreatedAt: time.Now()}
+	r.nextID++
+	r.users = append(r.users, u)
+	return u, r.save()
+}
+
+// tokenHandler issues a fresh bearer token for the logged-in user, for API
+// clients of someone who logged in through a provider and has no password
+func tokenHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := sessionUser(r)
+	if !ok {
+		http.Error(w, "Not logged in", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessionResponse{User: u.redacted(), Token: signSession(u.ID, time.Now().Add(sessionTTL))})
+}
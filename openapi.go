@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// openAPIHandler serves an OpenAPI 3 description of the management API,
+// generated from apiRoutes and the Go types they exchange
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openAPIDocument(apiRoutes()))
+}
+
+// pathParamPattern finds {wildcards} in a ServeMux path
+var pathParamPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+func openAPIDocument(routes []apiRoute) map[string]any {
+	gen := &schemaGen{components: map[string]any{}}
+	paths := map[string]map[string]any{}
+	for _, rt := range routes {
+		op := map[string]any{
+			"summary":     rt.Summary,
+			"operationId": operationID(rt),
+		}
+		var parameters []map[string]any
+		path := apiPrefix + rt.Path
+		for _, m := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+			// IDs and indexes are numbers; tokens and names aren't
+			typ := "string"
+			if m[1] == "id" || m[1] == "index" {
+				typ = "integer"
+			}
+			parameters = append(parameters, map[string]any{
+				"name": m[1], "in": "path", "required": true,
+				"schema": map[string]any{"type": typ},
+			})
+		}
+		for _, p := range rt.Params {
+			schema := map[string]any{"type": p.Type}
+			if p.Type == "array" {
+				schema["items"] = map[string]any{"type": "string"}
+			}
+			parameters = append(parameters, map[string]any{
+				"name": p.Name, "in": p.In, "description": p.Description, "schema": schema,
+			})
+		}
+		if parameters != nil {
+			op["parameters"] = parameters
+		}
+		if rt.Body != nil || rt.BodyType != "" {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  gen.content(rt.Body, rt.BodyType),
+			}
+		}
+
+		status := rt.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		resp := map[string]any{"description": http.StatusText(status)}
+		if rt.Response != nil {
+			resp["content"] = gen.content(rt.Response, rt.ResponseType)
+		}
+		op["responses"] = map[string]any{
+			strconv.Itoa(status): resp,
+			"default":            map[string]any{"description": "Error message", "content": gen.content("", "text/plain")},
+		}
+		if rt.Admin {
+			op["security"] = []map[string][]string{{"adminToken": {}}}
+		}
+
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(rt.Method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "webhook-host",
+			"version": strconv.Itoa(exportVersion),
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": gen.components,
+			"securitySchemes": map[string]any{
+				"adminToken": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// operationID names an operation after its handler, such as getRequests
+func operationID(rt apiRoute) string {
+	name := runtime.FuncForPC(reflect.ValueOf(rt.Handler).Pointer()).Name()
+	return strings.TrimSuffix(name[strings.LastIndex(name, ".")+1:], "Handler")
+}
+
+// schemaGen converts Go types into OpenAPI schemas, collecting named structs
+// under components
+type schemaGen struct {
+	components map[string]any
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// content returns an OpenAPI content map for v served as mediaType
+func (g *schemaGen) content(v any, mediaType string) map[string]any {
+	if mediaType == "" {
+		mediaType = "application/json"
+	}
+	var schema map[string]any
+	switch {
+	case v == nil || !strings.Contains(mediaType, "json") && !strings.HasPrefix(mediaType, "text/"):
+		schema = map[string]any{"type": "string", "format": "binary"}
+	default:
+		schema = g.schema(reflect.TypeOf(v))
+	}
+	return map[string]any{mediaType: map[string]any{"schema": schema}}
+}
+
+func (g *schemaGen) schema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		s := g.schema(t.Elem())
+		if _, isRef := s["$ref"]; !isRef {
+			s["nullable"] = true
+		}
+		return s
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := exportedName(t.Name())
+		if _, ok := g.components[name]; !ok {
+			// Reserve the name first so recursive types terminate
+			g.components[name] = nil
+			g.components[name] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+// object describes a struct's JSON fields
+func (g *schemaGen) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			required = append(required, name)
+		}
+	}
+	s := map[string]any{"type": "object", "properties": props}
+	if required != nil {
+		s["required"] = required
+	}
+	return s
+}
+
+// exportedName capitalises a Go type name for use as a schema name
+func exportedName(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
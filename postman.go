@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// postmanSchema identifies the Postman collection format written by
+// postmanExportHandler
+const postmanSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// Postman collection v2.1 types, covering the subset webhook-host fills in
+type postmanCollection struct {
+	Info     postmanInfo       `json:"info"`
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanVariable `json:"variable"`
+}
+
+type postmanInfo struct {
+	Name   string `json:"name"`
+	Schema string `json:"schema"`
+}
+
+type postmanItem struct {
+	Name    string         `json:"name"`
+	Request postmanRequest `json:"request"`
+}
+
+type postmanRequest struct {
+	Method      string          `json:"method"`
+	Header      []postmanHeader `json:"header"`
+	Body        *postmanBody    `json:"body,omitempty"`
+	URL         string          `json:"url"`
+	Description string          `json:"description,omitempty"`
+}
+
+type postmanHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type postmanBody struct {
+	Mode string `json:"mode"`
+	Raw  string `json:"raw"`
+}
+
+type postmanVariable struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// postmanExportHandler writes the requests matching the usual filter
+// parameters as a Postman collection. URLs are relative to a {{baseUrl}}
+// collection variable, preset to this server, so the whole collection can be
+// pointed at another service in one place.
+func postmanExportHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, err := store.List()
+	if err == nil {
+		list = filter.apply(list)
+		err = hydrateBodies(list)
+	}
+	if err != nil {
+		http.Error(w, "Failed to export requests", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	collection := postmanCollection{
+		Info: postmanInfo{
+			Name:   "webhook-host captures " + now.Format("2006-01-02 15:04:05"),
+			Schema: postmanSchema,
+		},
+		Item:     make([]postmanItem, 0, len(list)),
+		Variable: []postmanVariable{{Key: "baseUrl", Value: requestBase(r)}},
+	}
+	for _, info := range list {
+		collection.Item = append(collection.Item, newPostmanItem(info))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="webhook-host-%s.postman_collection.json"`, now.Format("20060102-150405")))
+	json.NewEncoder(w).Encode(collection)
+}
+
+// newPostmanItem converts a capture into a saved Postman request
+func newPostmanItem(info RequestInfo) postmanItem {
+	req := postmanRequest{
+		Method:      info.Method,
+		Header:      []postmanHeader{},
+		URL:         "{{baseUrl}}" + info.URL,
+		Description: info.Notes,
+	}
+	for k, values := range info.Headers {
+		if !replaySkips(info, k) {
+			for _, v := range values {
+				req.Header = append(req.Header, postmanHeader{Key: k, Value: v})
+			}
+		}
+	}
+	sort.SliceStable(req.Header, func(i, j int) bool { return req.Header[i].Key < req.Header[j].Key })
+	switch {
+	case info.BodyEncoding == "base64":
+		// Postman can't hold binary in a raw body
+		req.Description = strings.TrimSpace(req.Description + fmt.Sprintf("\n\nBinary body of %d bytes not included.", info.BodySize))
+	case info.Body != "":
+		req.Body = &postmanBody{Mode: "raw", Raw: info.Body}
+	}
+	return postmanItem{
+		Name:    fmt.Sprintf("#%d %s %s", info.ID, info.Method, requestPath(info)),
+		Request: req,
+	}
+}
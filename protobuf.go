@@ -0,0 +1,145 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protoTypes holds the messages from --proto-descriptors, or is nil
+var protoTypes *protoregistry.Files
+
+// protoRoutes maps path prefixes to the message their bodies hold, from
+// --proto-messages
+var protoRoutes []protoRoute
+
+type protoRoute struct {
+	prefix  string
+	message protoreflect.MessageDescriptor
+}
+
+// protoContentTypes are the media types protobuf bodies are sent with
+var protoContentTypes = []string{"application/x-protobuf", "application/protobuf", "application/vnd.google.protobuf", "application/octet-stream"}
+
+// loadProtoDescriptors reads the comma separated FileDescriptorSet files in
+// paths, as written by protoc --include_imports --descriptor_set_out, and
+// the comma separated prefix=package.Message routes in messages
+func loadProtoDescriptors(paths, messages string) error {
+	var set descriptorpb.FileDescriptorSet
+	seen := make(map[string]bool)
+	for _, path := range strings.Split(paths, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var fds descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(data, &fds); err != nil {
+			return fmt.Errorf("%s is not a descriptor set: %w", path, err)
+		}
+		// Sets built with --include_imports each carry their own copy of
+		// shared imports
+		for _, f := range fds.File {
+			if !seen[f.GetName()] {
+				seen[f.GetName()] = true
+				set.File = append(set.File, f)
+			}
+		}
+	}
+	if len(set.File) > 0 {
+		files, err := protodesc.NewFiles(&set)
+		if err != nil {
+			return err
+		}
+		protoTypes = files
+	}
+
+	for _, route := range strings.Split(messages, ",") {
+		route = strings.TrimSpace(route)
+		if route == "" {
+			continue
+		}
+		prefix, name, ok := strings.Cut(route, "=")
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("invalid message route %q; use /path/prefix=package.Message", route)
+		}
+		md, err := protoMessage(name)
+		if err != nil {
+			return err
+		}
+		protoRoutes = append(protoRoutes, protoRoute{prefix: prefix, message: md})
+	}
+	return nil
+}
+
+// protoMessage looks up a message type by its full name
+func protoMessage(name string) (protoreflect.MessageDescriptor, error) {
+	if protoTypes == nil {
+		return nil, fmt.Errorf("message %s: no --proto-descriptors loaded", name)
+	}
+	d, err := protoTypes.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("message %s: %w", name, err)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", name)
+	}
+	return md, nil
+}
+
+// decodeProtobuf renders a protobuf body as JSON, returning it with the
+// message name. The message is named by the Content-Type's messageType or
+// proto parameter, or else by the longest matching --proto-messages prefix.
+// Bodies it can't place or parse are left alone.
+func decodeProtobuf(r *http.Request, body []byte) (json.RawMessage, string) {
+	if protoTypes == nil || len(body) == 0 {
+		return nil, ""
+	}
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var md protoreflect.MessageDescriptor
+	if name := cmp.Or(params["messagetype"], params["proto"]); name != "" {
+		md, _ = protoMessage(name)
+	}
+	if md == nil {
+		longest := -1
+		for _, route := range protoRoutes {
+			if strings.HasPrefix(r.URL.Path, route.prefix) && len(route.prefix) > longest {
+				md, longest = route.message, len(route.prefix)
+			}
+		}
+		// A route only applies to protobuf or untyped binary bodies, not,
+		// say, JSON sent to the same path
+		if md != nil && mediaType != "" && !slices.Contains(protoContentTypes, mediaType) {
+			md = nil
+		}
+	}
+	if md == nil {
+		return nil, ""
+	}
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(body, msg); err != nil {
+		return nil, ""
+	}
+	out, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, ""
+	}
+	return out, "protobuf " + string(md.FullName())
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// trustedProxies are the addresses, set by --trusted-proxies, whose
+// forwarding headers are believed
+var trustedProxies []netip.Prefix
+
+// parseTrustedProxies reads a comma separated list of CIDRs and single
+// addresses
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if p, err := netip.ParsePrefix(part); err == nil {
+			out = append(out, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q; use a CIDR such as 10.0.0.0/8 or an address", part)
+		}
+		out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return out, nil
+}
+
+func isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	return slices.ContainsFunc(trustedProxies, func(p netip.Prefix) bool { return p.Contains(addr) })
+}
+
+// clientIP returns the address of the client behind a trusted proxy, taken
+// from Forwarded, X-Forwarded-For or X-Real-IP in that order of preference,
+// or "" when r didn't come through one. Forwarding chains are read from the
+// right, skipping further trusted proxies, since anything left of the last
+// untrusted hop could have been made up by the client.
+func clientIP(r *http.Request) string {
+	if !isTrustedProxy(sourceIP(r.RemoteAddr)) {
+		return ""
+	}
+	chains := [][]string{forwardedFor(r.Header.Values("Forwarded")), splitList(r.Header.Values("X-Forwarded-For"))}
+	for _, chain := range chains {
+		for i := len(chain) - 1; i >= 0; i-- {
+			ip := chain[i]
+			if _, err := netip.ParseAddr(ip); err != nil {
+				// Obfuscated or "unknown"; nothing further left can be trusted
+				break
+			}
+			if !isTrustedProxy(ip) || i == 0 {
+				return ip
+			}
+		}
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		if _, err := netip.ParseAddr(ip); err == nil {
+			return ip
+		}
+	}
+	return ""
+}
+
+// splitList splits comma separated header values into trimmed addresses
+func splitList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			out = append(out, forwardedAddr(part))
+		}
+	}
+	return out
+}
+
+// forwardedFor extracts the for= addresses from RFC 7239 Forwarded headers,
+// in order
+func forwardedFor(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				k, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(k, "for") {
+					out = append(out, forwardedAddr(val))
+				}
+			}
+		}
+	}
+	return out
+}
+
+// forwardedAddr strips quotes, IPv6 brackets and any port from a forwarded
+// node such as "[2001:db8::1]:4711" or 192.0.2.60
+func forwardedAddr(node string) string {
+	node = strings.Trim(strings.TrimSpace(node), `"`)
+	if strings.HasPrefix(node, "[") {
+		if end := strings.Index(node, "]"); end > 0 {
+			return node[1:end]
+		}
+	}
+	if strings.Count(node, ":") == 1 {
+		node, _, _ = strings.Cut(node, ":")
+	}
+	return node
+}
+
+// senderIP returns the best known address of whoever sent a capture: the
+// client behind a trusted proxy when there was one, else the direct peer
+func senderIP(info RequestInfo) string {
+	if info.ClientIP != "" {
+		return info.ClientIP
+	}
+	return sourceIP(info.RemoteAddr)
+}
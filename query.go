@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPageLimit caps ?limit= so a single response stays a sensible size
+const maxPageLimit = 1000
+
+// page is a limit/offset window over a result list. A zero limit means the
+// whole list.
+type page struct {
+	limit, offset int
+}
+
+func parsePage(q url.Values) (page, error) {
+	var p page
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if p.limit, err = strconv.Atoi(v); err != nil || p.limit < 1 {
+			return p, fmt.Errorf("invalid limit %q", v)
+		}
+		p.limit = min(p.limit, maxPageLimit)
+	}
+	if v := q.Get("offset"); v != "" {
+		if p.offset, err = strconv.Atoi(v); err != nil || p.offset < 0 {
+			return p, fmt.Errorf("invalid offset %q", v)
+		}
+	}
+	return p, nil
+}
+
+func (p page) apply(list []RequestInfo) []RequestInfo {
+	if p.offset >= len(list) {
+		return []RequestInfo{}
+	}
+	list = list[p.offset:]
+	if p.limit > 0 && p.limit < len(list) {
+		list = list[:p.limit]
+	}
+	return list
+}
+
+// sortOrder orders a result list by one field. The zero value keeps the
+// stores' newest-first order.
+type sortOrder struct {
+	field string
+	desc  bool
+}
+
+// sortFields are the fields ?sort= accepts
+var sortFields = []string{"timestamp", "size", "method"}
+
+// parseSort reads ?sort=timestamp|size|method&order=asc|desc. The order
+// defaults to descending, except for method which reads naturally A to Z.
+func parseSort(q url.Values) (sortOrder, error) {
+	s := sortOrder{field: q.Get("sort")}
+	if s.field == "" {
+		s.field = "timestamp"
+	}
+	if !slices.Contains(sortFields, s.field) {
+		return s, fmt.Errorf("invalid sort %q; use timestamp, size or method", s.field)
+	}
+	switch order := q.Get("order"); order {
+	case "":
+		s.desc = s.field != "method"
+	case "asc", "desc":
+		s.desc = order == "desc"
+	default:
+		return s, fmt.Errorf("invalid order %q; use asc or desc", order)
+	}
+	return s, nil
+}
+
+// apply sorts list in place. Ties keep their newest-first order.
+func (s sortOrder) apply(list []RequestInfo) {
+	if s.field == "" || s.field == "timestamp" && s.desc {
+		return
+	}
+	slices.SortStableFunc(list, func(a, b RequestInfo) int {
+		var c int
+		switch s.field {
+		case "timestamp":
+			c = a.Timestamp.Compare(b.Timestamp)
+		case "size":
+			c = a.BodySize - b.BodySize
+		case "method":
+			c = strings.Compare(a.Method, b.Method)
+		}
+		if s.desc {
+			return -c
+		}
+		return c
+	})
+}
+
+// Filter selects captures by their attributes. Zero fields match everything.
+type Filter struct {
+	Bin    string    // token of the bin, "" for every bin and unbinned captures
+	Method string    // case-insensitive exact match
+	Path   string    // prefix of the URL path
+	From   time.Time // inclusive
+	To     time.Time // exclusive
+	Tags   []string  // every tag must be present
+	Agent  string    // case-insensitive User-Agent product, such as GitHub-Hookshot
+	// Operation is a GraphQL operation name; "mutation" or another operation
+	// type matches every operation of that type
+	Operation string
+	// EventType is a CloudEvents type, such as com.example.order.created
+	EventType string
+	// DetectedType is the sniffed body type: json, xml, form, binary or text
+	DetectedType string
+	// Params are query parameters that must be present, as "name" or
+	// "name=value"; every one must match
+	Params []string
+	// Fields are form body fields that must be present, in the same forms
+	Fields []string
+	// SinceID keeps only captures newer than the given ID, for cheap polling
+	SinceID int
+
+	// allBins lets operator-configured filters see into protected bins,
+	// which other filters only match when scoped to them
+	allBins bool
+}
+
+// parseFilter reads a Filter from the query parameters listed in
+// filterParams; times are RFC 3339 or Unix seconds and tag, param and field
+// may repeat
+func parseFilter(q url.Values) (Filter, error) {
+	f := Filter{Bin: q.Get("bin"), Method: strings.ToUpper(q.Get("method")), Path: q.Get("path"), Tags: q["tag"], Params: q["param"],
+		Fields: q["field"], Agent: q.Get("agent"), Operation: q.Get("operation"), EventType: q.Get("event_type"),
+		DetectedType: q.Get("detected_type")}
+	var err error
+	if f.From, err = parseTime(q.Get("from")); err != nil {
+		return f, fmt.Errorf("invalid from: %w", err)
+	}
+	if f.To, err = parseTime(q.Get("to")); err != nil {
+		return f, fmt.Errorf("invalid to: %w", err)
+	}
+	if v := q.Get("since_id"); v != "" {
+		if f.SinceID, err = strconv.Atoi(v); err != nil || f.SinceID < 0 {
+			return f, fmt.Errorf("invalid since_id %q", v)
+		}
+	}
+	return f, nil
+}
+
+func parseTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// requestPath returns the path part of a capture's request URI
+func requestPath(info RequestInfo) string {
+	if u, err := url.ParseRequestURI(info.URL); err == nil {
+		return u.Path
+	}
+	return info.URL
+}
+
+// requestQuery returns a capture's decoded query parameters, parsing the URL
+// for captures stored before they were kept separately
+func requestQuery(info RequestInfo) url.Values {
+	if info.Query != nil {
+		return info.Query
+	}
+	if u, err := url.ParseRequestURI(info.URL); err == nil {
+		return u.Query()
+	}
+	return nil
+}
+
+// IsZero reports whether f matches every request
+func (f Filter) IsZero() bool {
+	return f.Bin == "" && f.Method == "" && f.Path == "" && f.From.IsZero() && f.To.IsZero() && len(f.Tags) == 0 &&
+		len(f.Params) == 0 && len(f.Fields) == 0 && f.Agent == "" && f.Operation == "" && f.EventType == "" && f.DetectedType == "" &&
+		f.SinceID == 0
+}
+
+func (f Filter) Match(info RequestInfo) bool {
+	if info.ID <= f.SinceID {
+		return false
+	}
+	if f.Bin != "" && info.Bin != f.Bin || !f.visible(info) {
+		return false
+	}
+	if f.Method != "" && info.Method != f.Method {
+		return false
+	}
+	if f.Path != "" && !strings.HasPrefix(requestPath(info), f.Path) {
+		return false
+	}
+	if !f.From.IsZero() && info.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !info.Timestamp.Before(f.To) {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !slices.Contains(info.Tags, tag) {
+			return false
+		}
+	}
+	if f.Agent != "" {
+		if ua := requestAgent(info); ua == nil || !strings.EqualFold(ua.Product, f.Agent) {
+			return false
+		}
+	}
+	if f.Operation != "" {
+		if gql := info.GraphQL; gql == nil || gql.OperationName != f.Operation && gql.OperationType != f.Operation {
+			return false
+		}
+	}
+	if f.EventType != "" && (info.CloudEvent == nil || info.CloudEvent.Type != f.EventType) {
+		return false
+	}
+	if f.DetectedType != "" && info.DetectedType != f.DetectedType {
+		return false
+	}
+	if len(f.Params) > 0 && !hasValues(requestQuery(info), f.Params) {
+		return false
+	}
+	return hasValues(info.Form, f.Fields)
+}
+
+// visible reports whether f may see info at all: captures in a bin with a
+// read token only show to filters scoped to that bin, and API requests get
+// those scopes only by presenting the token
+func (f Filter) visible(info RequestInfo) bool {
+	return info.Bin == "" || info.Bin == f.Bin || f.allBins || !bins.protected(info.Bin)
+}
+
+// hasValues reports whether v carries every one of wants, each "name" or
+// "name=value"
+func hasValues(v url.Values, wants []string) bool {
+	for _, want := range wants {
+		name, value, hasValue := strings.Cut(want, "=")
+		if !v.Has(name) || hasValue && !slices.Contains(v[name], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply returns the requests in list matching f, preserving order
+func (f Filter) apply(list []RequestInfo) []RequestInfo {
+	out := list[:0:0]
+	for _, info := range list {
+		if f.Match(info) {
+			out = append(out, info)
+		}
+	}
+	return out
+}
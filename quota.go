@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// binRateLimit and binMaxStorage, from --bin-rate-limit and
+// --bin-max-storage, cap every bin, the unscoped history included, unless
+// the bin sets its own; zero means no cap
+var (
+	binRateLimit  int
+	binMaxStorage int64
+)
+
+// rateIdle is how long a bin's request bucket goes untouched before it's
+// full again and can be forgotten
+const rateIdle = time.Minute
+
+// binQuota tracks one bin's request rate, as a token bucket refilled at the
+// per-minute limit
+type binQuota struct {
+	tokens float64
+	filled time.Time
+}
+
+// quotas holds the buckets of rate limited bins that had a webhook within
+// the last minute
+var quotas = struct {
+	mu    sync.Mutex
+	bins  map[string]*binQuota
+	swept time.Time
+}{bins: map[string]*binQuota{}}
+
+// limits returns b's request-per-minute and storage caps
+func (b Bin) limits() (rate int, storage int64) {
+	rate, storage = binRateLimit, binMaxStorage
+	if b.RateLimit > 0 {
+		rate = b.RateLimit
+	}
+	if b.MaxStorage > 0 {
+		storage = b.MaxStorage
+	}
+	return rate, storage
+}
+
+// quotaFor returns bin's bucket, forgetting those of bins gone idle once a
+// minute, so sending to random tokens can't pile them up; callers hold
+// quotas.mu
+func quotaFor(bin string, now time.Time) *binQuota {
+	if now.Sub(quotas.swept) >= rateIdle {
+		for token, q := range quotas.bins {
+			if now.Sub(q.filled) >= rateIdle {
+				delete(quotas.bins, token)
+			}
+		}
+		quotas.swept = now
+	}
+	q, ok := quotas.bins[bin]
+	if !ok {
+		q = &binQuota{}
+		quotas.bins[bin] = q
+	}
+	return q
+}
+
+// takeRequest spends one of bin's requests for this minute, or returns how
+// long until one is free
+func takeRequest(bin string, perMinute int, now time.Time) (time.Duration, bool) {
+	if perMinute <= 0 {
+		return 0, true
+	}
+	quotas.mu.Lock()
+	defer quotas.mu.Unlock()
+	q := quotaFor(bin, now)
+	limit := float64(perMinute)
+	if q.filled.IsZero() {
+		q.tokens = limit
+	} else {
+		q.tokens = min(limit, q.tokens+now.Sub(q.filled).Minutes()*limit)
+	}
+	q.filled = now
+	if q.tokens < 1 {
+		return time.Duration((1 - q.tokens) / limit * float64(time.Minute)), false
+	}
+	q.tokens--
+	return 0, true
+}
+
+// storageUsed returns roughly how many bytes s holds for bin
+func storageUsed(s Store, bin string) int64 {
+	_, bytes := binTotals(s, bin)
+	return bytes
+}
+
+// retryAfter renders d as whole seconds for a Retry-After header
+func retryAfter(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
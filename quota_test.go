@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withQuotas sets --bin-rate-limit and --bin-max-storage for one test
+func withQuotas(t *testing.T, rate int, storage int64) {
+	t.Helper()
+	binRateLimit, binMaxStorage = rate, storage
+	quotas.mu.Lock()
+	quotas.bins = map[string]*binQuota{}
+	quotas.mu.Unlock()
+	t.Cleanup(func() { binRateLimit, binMaxStorage = 0, 0 })
+}
+
+func TestBinRateLimit(t *testing.T) {
+	srv := newTestServer(t)
+	withQuotas(t, 2, 0)
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if status, body := send(t, srv, "POST", "/b/busy/hook", "x"); status != want {
+			t.Errorf("webhook %d = %d, want %d: %s", i+1, status, want, body)
+		}
+	}
+	if status, _ := send(t, srv, "POST", "/b/quiet/hook", "x"); status != http.StatusOK {
+		t.Errorf("another bin = %d; bins are limited separately", status)
+	}
+}
+
+func TestBinStorageQuota(t *testing.T) {
+	srv := newTestServer(t)
+	withQuotas(t, 0, 4096)
+	body := strings.Repeat("x", 1024)
+	full := 0
+	for i := 0; i < 10 && full == 0; i++ {
+		if status, _ := send(t, srv, "POST", "/b/big/hook", body); status == http.StatusTooManyRequests {
+			full = i
+		}
+	}
+	if full == 0 {
+		t.Fatal("storage quota never answered 429")
+	}
+	if status, _ := send(t, srv, "POST", "/b/small/hook", body); status != http.StatusOK {
+		t.Errorf("another bin = %d; quotas are per bin", status)
+	}
+	send(t, srv, "POST", "/api/v1/clear?bin=big", "")
+	if status, body := send(t, srv, "POST", "/b/big/hook", body); status != http.StatusOK {
+		t.Errorf("after clearing the bin = %d: %s", status, body)
+	}
+}
+
+func TestTallyFollowsWrites(t *testing.T) {
+	s := newTallyStore(newMemoryStore())
+	for range 3 {
+		s.Add(&RequestInfo{Bin: "a", Body: "abc"})
+	}
+	s.Add(&RequestInfo{Bin: "b", Body: "abc"})
+	if n, _ := binTotals(s, "a"); n != 3 {
+		t.Fatalf("counted %d in a, want 3", n)
+	}
+	list, _ := s.List() // newest first, b then a
+	s.Update(list[1].ID, func(info *RequestInfo) { info.Pinned = true })
+	s.Delete(list[2].ID)
+	s.Add(&RequestInfo{Bin: "a", Body: "abc"})
+	n, bytes := binTotals(s, "a")
+	if n != 2 {
+		t.Errorf("counted %d unpinned in a after pin, delete and add, want 2", n)
+	}
+	if want := 3 * approxSize(RequestInfo{Bin: "a", Body: "abc"}); bytes != want {
+		t.Errorf("a takes %d bytes, want %d", bytes, want)
+	}
+	s.Clear()
+	if n, bytes := binTotals(s, "a"); n != 0 || bytes != 0 {
+		t.Errorf("after clear a holds %d, %d bytes", n, bytes)
+	}
+}
+
+func TestTallyCatchesUpWithSharedBackend(t *testing.T) {
+	backend := newMemoryStore()
+	mine, theirs := newTallyStore(backend), newTallyStore(backend)
+	mine.Add(&RequestInfo{Bin: "a"})
+	if n, _ := binTotals(mine, "a"); n != 1 {
+		t.Fatalf("counted %d, want 1", n)
+	}
+	theirs.Add(&RequestInfo{Bin: "a"})
+	if n, _ := binTotals(mine, "a"); n != 1 {
+		t.Fatalf("counted %d before a refresh, want 1", n)
+	}
+	mine.mu.Lock()
+	mine.counted = time.Now().Add(-tallyRefresh)
+	mine.mu.Unlock()
+	if err := mine.count(false); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := binTotals(mine, "a"); n != 2 {
+		t.Errorf("counted %d after a refresh, want 2", n)
+	}
+}
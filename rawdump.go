@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+)
+
+// rawDump keeps each capture's request as it came off the wire, set by
+// --raw-dump
+var rawDump bool
+
+// rawDumpMax bounds the bytes recorded for one request; longer requests fall
+// back to a reconstructed dump
+const rawDumpMax = 64 << 20
+
+// recordingConn keeps a copy of everything read from a plain HTTP
+// connection since the last reset. net/http only ever sees parsed headers,
+// in a map, so this is the one place their order and casing survive.
+type recordingConn struct {
+	net.Conn
+	mu       sync.Mutex
+	buf      []byte
+	overflow bool
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.mu.Lock()
+		if len(c.buf)+n > rawDumpMax {
+			c.overflow = true
+		} else if !c.overflow {
+			c.buf = append(c.buf, p[:n]...)
+		}
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+// reset drops what has been recorded, between requests on the connection
+func (c *recordingConn) reset() {
+	c.mu.Lock()
+	c.buf, c.overflow = c.buf[:0], false
+	c.mu.Unlock()
+}
+
+// since returns a copy of what was recorded from the first occurrence of
+// start, or false when start wasn't seen or the recording overflowed
+func (c *recordingConn) since(start []byte) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := bytes.Index(c.buf, start)
+	if c.overflow || i < 0 {
+		return nil, false
+	}
+	return bytes.Clone(c.buf[i:]), true
+}
+
+// recordingListener wraps accepted connections in recordingConns
+type recordingListener struct {
+	net.Listener
+}
+
+func (l recordingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &recordingConn{Conn: c}, nil
+}
+
+// rawRequest returns r as sent, reporting true, when its connection was
+// recorded. Otherwise, as for HTTPS, it reports false and rebuilds the
+// request with httputil.DumpRequest, which can't recover header order or
+// casing. r's body must already have been read into body.
+func rawRequest(r *http.Request, body []byte) ([]byte, bool) {
+	if stats, ok := r.Context().Value(connStatsKey{}).(*connStats); ok && stats.raw != nil {
+		// Anything before the request line is left over from an earlier
+		// request whose unread body the server discarded
+		if raw, ok := stats.raw.since(fmt.Appendf(nil, "%s %s %s\r\n", r.Method, r.RequestURI, r.Proto)); ok {
+			return raw, true
+		}
+	}
+	return dumpRequest(r, body), false
+}
+
+// dumpRequest rebuilds r in wire format around body
+func dumpRequest(r *http.Request, body []byte) []byte {
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	raw, err := httputil.DumpRequest(r, true)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+// requestRawHandler serves the recorded wire-format request of a capture
+// taken with --raw-dump
+func requestRawHandler(w http.ResponseWriter, r *http.Request) {
+	info, ok := requestFromPath(w, r)
+	if !ok {
+		return
+	}
+	if info.Raw == nil {
+		http.Error(w, "No raw dump recorded for this request; start with --raw-dump", http.StatusNotFound)
+		return
+	}
+	writeDownload(w, "message/http", fmt.Sprintf("request-%d.http", info.ID), info.Raw)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// hostnameTTL is how long a reverse lookup, found or not, is reused
+	hostnameTTL = time.Hour
+	// hostnameCacheMax bounds the cache; it's emptied when full
+	hostnameCacheMax = 10000
+)
+
+// hostnames resolves senders to hostnames with --reverse-dns, or is nil
+var hostnames *hostnameCache
+
+type hostnameEntry struct {
+	name    string
+	expires time.Time
+}
+
+// hostnameCache runs reverse DNS lookups off the request path and remembers
+// the answers. Captures that arrive while their address is being looked up
+// are all filled in when it finishes.
+type hostnameCache struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	entries map[string]hostnameEntry
+	pending map[string][]int
+}
+
+func newHostnameCache(timeout time.Duration) *hostnameCache {
+	return &hostnameCache{timeout: timeout, entries: make(map[string]hostnameEntry), pending: make(map[string][]int)}
+}
+
+// cached returns the hostname of ip when it has been looked up recently,
+// reporting false when it needs looking up
+func (c *hostnameCache) cached(ip string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[ip]
+	if !ok || time.Now().After(e.expires) {
+		return "", false
+	}
+	return e.name, true
+}
+
+// resolve looks ip up in the background and records the answer on the
+// stored capture id
+func (c *hostnameCache) resolve(id int, ip string) {
+	c.mu.Lock()
+	if e, ok := c.entries[ip]; ok && time.Now().Before(e.expires) {
+		c.mu.Unlock()
+		setHostname(id, e.name)
+		return
+	}
+	ids, running := c.pending[ip]
+	c.pending[ip] = append(ids, id)
+	c.mu.Unlock()
+	if !running {
+		go c.lookup(ip)
+	}
+}
+
+func (c *hostnameCache) lookup(ip string) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	var name string
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	if err == nil && len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= hostnameCacheMax {
+		clear(c.entries)
+	}
+	c.entries[ip] = hostnameEntry{name: name, expires: time.Now().Add(hostnameTTL)}
+	ids := c.pending[ip]
+	delete(c.pending, ip)
+	c.mu.Unlock()
+
+	for _, id := range ids {
+		setHostname(id, name)
+	}
+}
+
+func setHostname(id int, name string) {
+	if name == "" {
+		return
+	}
+	err := store.Update(id, func(i *RequestInfo) { i.Hostname = name })
+	if err != nil && err != ErrNotFound {
+		log.Printf("Failed to record hostname: %v", err)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// redactedValue replaces every masked value
+const redactedValue = "[REDACTED]"
+
+// redactions are the --redact rules, applied to every capture before it's
+// stored, published or dumped
+var redactions *redactRules
+
+// redactRules masks values by where they appear. Names are matched case
+// insensitively and may use * wildcards.
+type redactRules struct {
+	headers, query, form, cookies []string
+	paths                         [][]string // JSON paths, split into steps
+}
+
+// parseRedactions reads comma separated rules: "$.card.number" style JSON
+// paths (with [n] or [*] for array items and * for any key), "query:name",
+// "form:name", "cookie:name", and bare header names such as Authorization
+// or X-Api-*. It returns nil for no rules.
+func parseRedactions(s string) (*redactRules, error) {
+	var rules redactRules
+	n := 0
+	for _, rule := range strings.Split(s, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		n++
+		if strings.HasPrefix(rule, "$") {
+			steps, err := parseJSONPath(rule)
+			if err != nil {
+				return nil, err
+			}
+			rules.paths = append(rules.paths, steps)
+			continue
+		}
+		kind, name, ok := strings.Cut(rule, ":")
+		if !ok {
+			kind, name = "header", rule
+		}
+		name = strings.ToLower(name)
+		if _, err := path.Match(name, ""); err != nil || name == "" {
+			return nil, fmt.Errorf("invalid redaction %q", rule)
+		}
+		switch kind {
+		case "header":
+			rules.headers = append(rules.headers, name)
+		case "query":
+			rules.query = append(rules.query, name)
+		case "form":
+			rules.form = append(rules.form, name)
+		case "cookie":
+			rules.cookies = append(rules.cookies, name)
+		default:
+			return nil, fmt.Errorf("invalid redaction %q; use a header name, $.json.path, query:, form: or cookie:", rule)
+		}
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	return &rules, nil
+}
+
+// parseJSONPath splits "$.a.b[0].c[*]" into ["a", "b", "0", "c", "*"]
+func parseJSONPath(p string) ([]string, error) {
+	rest := strings.TrimPrefix(p, "$")
+	var steps []string
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			steps = append(steps, rest[1:end+1])
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q: unclosed [", p)
+			}
+			steps = append(steps, strings.Trim(rest[1:end], `'"`))
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid JSON path %q; use $.field.sub or $.list[*].field", p)
+		}
+	}
+	if len(steps) == 0 || slices.Contains(steps, "") {
+		return nil, fmt.Errorf("invalid JSON path %q", p)
+	}
+	return steps, nil
+}
+
+func matchName(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// apply masks r's matching headers, trailers, cookies and query parameters
+// and body's matching JSON values and form fields. body must already be
+// decompressed. When anything was masked it returns a copy of r and the
+// masked body, reporting true; otherwise r and body come back unchanged.
+func (rr *redactRules) apply(r *http.Request, body []byte) (*http.Request, []byte, bool) {
+	if rr == nil {
+		return r, body, false
+	}
+	out := r.Clone(r.Context())
+	changed := false
+	for _, h := range []http.Header{out.Header, out.Trailer} {
+		for name, values := range h {
+			if matchName(rr.headers, name) {
+				for i := range values {
+					values[i] = redactedValue
+				}
+				changed = true
+			}
+		}
+	}
+	if len(rr.cookies) > 0 {
+		for i, c := range out.Header["Cookie"] {
+			if masked, ok := rr.maskPairs(c, "; ", rr.cookies, false); ok {
+				out.Header["Cookie"][i], changed = masked, true
+			}
+		}
+	}
+	if len(rr.query) > 0 && out.URL.RawQuery != "" {
+		if masked, ok := rr.maskPairs(out.URL.RawQuery, "&", rr.query, true); ok {
+			out.URL.RawQuery, changed = masked, true
+			out.RequestURI = out.URL.RequestURI()
+		}
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case len(rr.form) > 0 && mediaType == "application/x-www-form-urlencoded":
+		if masked, ok := rr.maskPairs(string(body), "&", rr.form, true); ok {
+			body, changed = []byte(masked), true
+		}
+	case len(rr.form) > 0 && mediaType == "multipart/form-data":
+		if masked, ok := rr.maskMultipart(body, params["boundary"]); ok {
+			body, changed = masked, true
+		}
+	case len(rr.paths) > 0 && json.Valid(body):
+		if masked, ok := rr.maskJSON(body); ok {
+			body, changed = masked, true
+		}
+	}
+	if !changed {
+		return r, body, false
+	}
+	return out, body, true
+}
+
+// maskPairs masks the values of matching name=value pairs in s, which are
+// joined by sep and, when escaped, URL-encoded, keeping their order
+func (rr *redactRules) maskPairs(s, sep string, names []string, escaped bool) (string, bool) {
+	pairs := strings.Split(s, sep)
+	changed := false
+	for i, pair := range pairs {
+		name, _, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		if escaped {
+			if n, err := url.QueryUnescape(name); err == nil {
+				name = n
+			}
+		}
+		if matchName(names, name) {
+			value := redactedValue
+			if escaped {
+				value = url.QueryEscape(value)
+			}
+			pairs[i] = pair[:strings.Index(pair, "=")+1] + value
+			changed = true
+		}
+	}
+	return strings.Join(pairs, sep), changed
+}
+
+// maskMultipart rewrites a multipart body with matching fields' contents
+// masked, keeping the boundary and part headers
+func (rr *redactRules) maskMultipart(body []byte, boundary string) ([]byte, bool) {
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	var out bytes.Buffer
+	mw := multipart.NewWriter(&out)
+	if mw.SetBoundary(boundary) != nil {
+		return nil, false
+	}
+	changed := false
+	for {
+		part, err := mr.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, false
+		}
+		if matchName(rr.form, part.FormName()) {
+			data, changed = []byte(redactedValue), true
+		}
+		w, err := mw.CreatePart(textproto.MIMEHeader(part.Header))
+		if err != nil {
+			return nil, false
+		}
+		w.Write(data)
+	}
+	if !changed || mw.Close() != nil {
+		return nil, false
+	}
+	return out.Bytes(), true
+}
+
+// maskJSON replaces the values at the rules' JSON paths, keeping the
+// document's key order
+func (rr *redactRules) maskJSON(body []byte) ([]byte, bool) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	doc, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, false
+	}
+	changed := false
+	for _, steps := range rr.paths {
+		if maskPath(&doc, steps) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, false
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// maskPath replaces what steps lead to from v, reporting whether anything
+// was found
+func maskPath(v *any, steps []string) bool {
+	if len(steps) == 0 {
+		*v = redactedValue
+		return true
+	}
+	step, found := steps[0], false
+	switch node := (*v).(type) {
+	case orderedObject:
+		for i := range node {
+			if step == "*" || node[i].Key == step {
+				found = maskPath(&node[i].Value, steps[1:]) || found
+			}
+		}
+	case []any:
+		for i := range node {
+			if step == "*" || step == strconv.Itoa(i) {
+				found = maskPath(&node[i], steps[1:]) || found
+			}
+		}
+	}
+	return found
+}
+
+// orderedObject is a JSON object that remembers its key order
+type orderedObject []orderedField
+
+type orderedField struct {
+	Key   string
+	Value any
+}
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.Key)
+		value, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// decodeOrdered reads one JSON value, with objects as orderedObjects
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := orderedObject{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, orderedField{Key: key.(string), Value: value})
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		list := []any{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := dec.Token()
+		return list, err
+	}
+	return tok, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// Reply is how a captured webhook is answered, so a bin can stand in for the
+// real receiver: {"status": 503} to exercise a sender's retries, or a JSON
+// body the sender expects to parse.
+type Reply struct {
+	Status  int               `json:"status,omitempty"` // default 200
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	// Template makes Body and the header values Go templates, executed with
+	// the capture as dot, such as {{json "challenge"}} to answer a
+	// verification handshake
+	Template bool `json:"template,omitempty"`
+	// Echo answers with the request's own body and Content-Type instead of
+	// Body, for seeing what a client really serialized
+	Echo bool `json:"echo,omitempty"`
+}
+
+// builtinReply is how webhooks were always answered, and still are unless
+// configured otherwise
+var builtinReply = Reply{Status: http.StatusOK, Body: webhookReply}
+
+// defaultReply answers webhooks to bins without a reply of their own
+var defaultReply = builtinReply
+
+// builtin reports whether rep is builtinReply, which captures don't record
+func (rep Reply) builtin() bool {
+	return rep.status() == http.StatusOK && rep.Body == webhookReply && len(rep.Headers) == 0 && !rep.Template && !rep.Echo
+}
+
+// parseDefaultReply builds the answer to webhooks from --response-status,
+// --response-content-type, --response-header, --response-body,
+// --response-template and --echo
+func parseDefaultReply(status int, contentType string, headers []string, body string, tmpl, echo bool) (Reply, error) {
+	rep := Reply{Status: status, Body: body, Template: tmpl, Echo: echo}
+	for _, h := range headers {
+		k, v, ok := strings.Cut(h, ":")
+		if !ok {
+			return Reply{}, fmt.Errorf("header %q is not Name: value", h)
+		}
+		if rep.Headers == nil {
+			rep.Headers = map[string]string{}
+		}
+		rep.Headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	if contentType != "" {
+		if rep.Headers == nil {
+			rep.Headers = map[string]string{}
+		}
+		rep.Headers["Content-Type"] = contentType
+	}
+	return rep, rep.validate()
+}
+
+// validate reports what's wrong with a reply configured through the API
+func (rep Reply) validate() error {
+	if rep.Status != 0 && (rep.Status < 100 || rep.Status > 599) {
+		return fmt.Errorf("status %d is not an HTTP status", rep.Status)
+	}
+	for k, v := range rep.Headers {
+		if !httpguts.ValidHeaderFieldName(k) {
+			return fmt.Errorf("invalid header name %q", k)
+		}
+		if !httpguts.ValidHeaderFieldValue(v) {
+			return fmt.Errorf("invalid value for header %s", k)
+		}
+	}
+	return rep.validateTemplate()
+}
+
+// status returns the status rep answers with
+func (rep Reply) status() int {
+	if rep.Status == 0 {
+		return http.StatusOK
+	}
+	return rep.Status
+}
+
+// contentType returns the Content-Type rep is sent with: its own, or JSON
+// for a JSON body, which is what {"ok":true} means, or plain text
+func (rep Reply) contentType() string {
+	for k, v := range rep.Headers {
+		if http.CanonicalHeaderKey(k) == "Content-Type" {
+			return v
+		}
+	}
+	if rep.Body != "" && json.Valid([]byte(rep.Body)) {
+		return "application/json"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// write answers a webhook with rep. Replies are set by any editor and
+// served on the UI's origin, so like downloads they're kept from running
+// script there, whatever Content-Type they claim.
+func (rep Reply) write(w http.ResponseWriter) {
+	for k, v := range rep.Headers {
+		w.Header().Set(k, v)
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	status := rep.status()
+	if !bodyAllowed(status) {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", rep.contentType())
+	w.WriteHeader(status)
+	io.WriteString(w, rep.Body)
+}
+
+// bodyAllowed reports whether a response with status may have a body
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// replyFor returns how webhooks to b are answered
+func replyFor(b Bin) Reply {
+	if b.Response != nil {
+		return *b.Response
+	}
+	return defaultReply
+}
+
+// setResponse replaces the reply of the created bin token, or restores the
+// default when rep is nil
+func (r *binRegistry) setResponse(token string, rep *Reply) (Bin, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.bins[token]
+	if !ok {
+		return Bin{}, ErrNotFound
+	}
+	b.Response = rep
+	r.bins[token] = b
+	return b, r.save()
+}
+
+// binPatch is the body accepted when changing a bin's settings
+type binPatch struct {
+	// Response replaces how the bin's webhooks are answered; null goes back
+	// to the default
+	Response *Reply `json:"response"`
+}
+
+// patchBinHandler changes how a created bin answers, from a body such as
+// {"response": {"status": 200, "body": "{\"ok\":true}"}}. It takes the
+// bin's read token, password or owner's login.
+func patchBinHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.PathValue("token")
+	b := bins.get(token)
+	if b.Token == "" {
+		http.Error(w, "Bin not found; only created bins have settings", http.StatusNotFound)
+		return
+	}
+	if !hasBinCredentials(r, b) {
+		binUnauthorized(w, token)
+		return
+	}
+	var patch binPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if patch.Response != nil {
+		if err := patch.Response.validate(); err != nil {
+			http.Error(w, "Invalid response: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	b, err := bins.setResponse(token, patch.Response)
+	if err != nil {
+		http.Error(w, "Failed to save bin", http.StatusInternalServerError)
+		return
+	}
+	b.PasswordHash = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b)
+}
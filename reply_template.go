@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// replyTemplates caches parsed response templates by their text
+var replyTemplates sync.Map
+
+// replyFuncs are the helpers response templates get beyond the capture's
+// own fields: {{json "challenge"}} reads the body, {{header "X-Id"}},
+// {{query "q"}} and {{form "f"}} the first value of a header, query
+// parameter or form field, and {{match 1}} or {{match "id"}} a group of the
+// rule that matched
+func replyFuncs(info RequestInfo) template.FuncMap {
+	return template.FuncMap{
+		"match":  func(group any) string { return info.RuleGroups[fmt.Sprint(group)] },
+		"json":   func(path string) (string, error) { return jsonField(info, path) },
+		"header": func(name string) string { return info.Headers.Get(name) },
+		"query":  func(name string) string { return info.Query.Get(name) },
+		"form":   func(name string) string { return info.Form.Get(name) },
+	}
+}
+
+// parseReplyTemplate parses text as a response template, caching the result
+func parseReplyTemplate(text string) (*template.Template, error) {
+	if t, ok := replyTemplates.Load(text); ok {
+		return t.(*template.Template), nil
+	}
+	// The helpers are bound to each capture when executed
+	t, err := template.New("reply").Funcs(replyFuncs(RequestInfo{})).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	replyTemplates.Store(text, t)
+	return t, nil
+}
+
+// executeReplyTemplate renders text with info as dot
+func executeReplyTemplate(text string, info RequestInfo) (string, error) {
+	t, err := parseReplyTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	t, err = t.Clone()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Funcs(replyFuncs(info)).Execute(&b, info); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// validateTemplate checks a templated reply's body and header values parse
+func (rep Reply) validateTemplate() error {
+	if !rep.Template {
+		return nil
+	}
+	if _, err := parseReplyTemplate(rep.Body); err != nil {
+		return fmt.Errorf("body template: %w", err)
+	}
+	for k, v := range rep.Headers {
+		if _, err := parseReplyTemplate(v); err != nil {
+			return fmt.Errorf("template for header %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// render returns rep with its templates, if any, executed against info and
+// everything else as it was
+func (rep Reply) render(info RequestInfo) (Reply, error) {
+	if !rep.Template {
+		return rep, nil
+	}
+	out := rep
+	out.Template, out.Headers = false, nil
+	var err error
+	if out.Body, err = executeReplyTemplate(rep.Body, info); err != nil {
+		return Reply{}, err
+	}
+	if len(rep.Headers) > 0 {
+		out.Headers = make(map[string]string, len(rep.Headers))
+	}
+	for k, v := range rep.Headers {
+		if out.Headers[k], err = executeReplyTemplate(v, info); err != nil {
+			return Reply{}, err
+		}
+	}
+	return out, out.validate()
+}
+
+// jsonField returns what path, such as challenge or $.event.id, leads to in
+// info's JSON body, or its msgpack, CBOR or protobuf body decoded to JSON.
+// Strings come out as they are and anything else as JSON; a missing field
+// gives "".
+func jsonField(info RequestInfo, path string) (string, error) {
+	if !strings.HasPrefix(path, "$") {
+		path = "$." + path
+	}
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return "", err
+	}
+	data := []byte(info.Body)
+	if info.DecodedBody != nil {
+		data = info.DecodedBody
+	}
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if dec.Decode(&v) != nil {
+		return "", nil
+	}
+	for _, step := range steps {
+		switch node := v.(type) {
+		case map[string]any:
+			v = node[step]
+		case []any:
+			i, err := strconv.Atoi(step)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", nil
+			}
+			v = node[i]
+		default:
+			return "", nil
+		}
+	}
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	out, err := json.Marshal(v)
+	return string(out), err
+}
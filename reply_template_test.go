@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/url"
+	"testing"
+)
+
+func TestReplyRender(t *testing.T) {
+	info := RequestInfo{
+		Body:    `{"challenge":"abc","event":{"id":7}}`,
+		Headers: Header{"X-Id": {"42"}},
+		Query:   url.Values{"q": {"search"}},
+	}
+	tests := []struct {
+		name string
+		rep  Reply
+		want Reply
+	}{
+		{
+			"plain reply as it was",
+			Reply{Status: 201, Body: "{{json \"challenge\"}}", Headers: map[string]string{"X-A": "{{header \"X-Id\"}}"}},
+			Reply{Status: 201, Body: "{{json \"challenge\"}}", Headers: map[string]string{"X-A": "{{header \"X-Id\"}}"}},
+		},
+		{
+			"body and headers executed",
+			Reply{Status: 202, Body: `{"challenge":"{{json "challenge"}}","event":{{json "$.event"}}}`, Headers: map[string]string{"X-Id": "{{header \"X-Id\"}}", "X-Q": "{{query \"q\"}}"}, Template: true},
+			Reply{Status: 202, Body: `{"challenge":"abc","event":{"id":7}}`, Headers: map[string]string{"X-Id": "42", "X-Q": "search"}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := tt.rep.render(info)
+		if err != nil {
+			t.Errorf("%s: render: %v", tt.name, err)
+			continue
+		}
+		if got.Status != tt.want.Status || got.Body != tt.want.Body || got.Template != tt.want.Template || !maps.Equal(got.Headers, tt.want.Headers) {
+			t.Errorf("%s: render = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReplyRenderInvalidHeader(t *testing.T) {
+	rep := Reply{Headers: map[string]string{"X-Body": "{{.Body}}"}, Template: true}
+	if _, err := rep.render(RequestInfo{Body: "a\nb"}); err == nil {
+		t.Error("render let a newline into a header value")
+	}
+}
+
+func TestJSONField(t *testing.T) {
+	info := RequestInfo{Body: `{"challenge":"abc","event":{"id":7,"ok":true},"items":[{"sku":"x"},{"sku":"y"}],"none":null}`}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"challenge", "abc"},
+		{"$.challenge", "abc"},
+		{"event.id", "7"},
+		{"$.event", `{"id":7,"ok":true}`},
+		{"$.items[1].sku", "y"},
+		{"items[2].sku", ""},
+		{"$.items[x]", ""},
+		{"missing", ""},
+		{"none", ""},
+		{"challenge.deeper", ""},
+	}
+	for _, tt := range tests {
+		got, err := jsonField(info, tt.path)
+		if err != nil || got != tt.want {
+			t.Errorf("jsonField(%q) = %q, %v; want %q", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestJSONFieldDecodedBody(t *testing.T) {
+	info := RequestInfo{Body: "\x81\xa1a\x01", DecodedBody: json.RawMessage(`{"a":1}`)}
+	if got, err := jsonField(info, "a"); err != nil || got != "1" {
+		t.Errorf("jsonField = %q, %v; want 1", got, err)
+	}
+	if got, err := jsonField(RequestInfo{Body: "not json"}, "a"); err != nil || got != "" {
+		t.Errorf("jsonField of a text body = %q, %v; want empty", got, err)
+	}
+	if _, err := jsonField(info, "$a["); err == nil {
+		t.Error("jsonField accepted an invalid path")
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// requestFromPath loads the request named by the {id} path segment, writing
+// an error response and returning false when it can't
+func requestFromPath(w http.ResponseWriter, r *http.Request) (RequestInfo, bool) {
+	return requestByID(w, r, r.PathValue("id"))
+}
+
+// requestByID loads the request with the given ID string, writing an error
+// response and returning false when it can't or when r may not read its bin
+func requestByID(w http.ResponseWriter, r *http.Request, v string) (RequestInfo, bool) {
+	id, err := strconv.Atoi(v)
+	if err != nil {
+		http.Error(w, "Invalid request ID", http.StatusBadRequest)
+		return RequestInfo{}, false
+	}
+	info, err := store.Get(id)
+	if err == nil && (!canReadCapture(r, info) || !captureInScope(r, info)) {
+		// Other tenants can't even learn the ID exists
+		err = ErrNotFound
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Request not found", http.StatusNotFound)
+		return info, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to load request", http.StatusInternalServerError)
+		return info, false
+	}
+	return info, true
+}
+
+// getRequestHandler returns one capture with its full body, even when the
+// list endpoint only carries a spilled preview
+func getRequestHandler(w http.ResponseWriter, r *http.Request) {
+	info, ok := requestFromPath(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// requestBodyHandler serves a capture's body byte for byte as stored, which
+// is as received apart from any Content-Encoding, with its original
+// Content-Type
+func requestBodyHandler(w http.ResponseWriter, r *http.Request) {
+	info, ok := requestFromPath(w, r)
+	if !ok {
+		return
+	}
+	body, err := info.rawBody()
+	if err != nil {
+		http.Error(w, "Failed to decode body", http.StatusInternalServerError)
+		return
+	}
+	writeDownload(w, info.Headers.Get("Content-Type"), fmt.Sprintf("request-%d.body", info.ID), body)
+}
+
+// writeDownload sends captured bytes as an attachment. The content is
+// whatever a sender chose, so browsers are kept from rendering it on this
+// origin, where a captured HTML page could script the UI.
+func writeDownload(w http.ResponseWriter, contentType, filename string, data []byte) {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// requestPatch holds the annotation fields PATCH may change; nil fields are
+// left as they are
+type requestPatch struct {
+	Notes *string `json:"notes"`
+	// Tags replaces the tag set; AddTags and RemoveTags adjust it
+	Tags       *[]string `json:"tags"`
+	AddTags    []string  `json:"add_tags"`
+	RemoveTags []string  `json:"remove_tags"`
+	Pinned     *bool     `json:"pinned"`
+}
+
+func (p requestPatch) apply(info *RequestInfo) {
+	if p.Notes != nil {
+		info.Notes = *p.Notes
+	}
+	if p.Pinned != nil {
+		info.Pinned = *p.Pinned
+	}
+	if p.Tags != nil {
+		info.Tags = nil
+		p.AddTags = append(*p.Tags, p.AddTags...)
+	}
+	for _, tag := range p.AddTags {
+		if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(info.Tags, tag) {
+			info.Tags = append(info.Tags, tag)
+		}
+	}
+	// Clone first: listed copies of the request may share the old slice
+	info.Tags = slices.DeleteFunc(slices.Clone(info.Tags), func(tag string) bool {
+		return slices.Contains(p.RemoveTags, tag)
+	})
+}
+
+// patchRequestHandler updates a capture's annotations from a JSON body such
+// as {"notes": "this is the failing retry", "add_tags": ["PROJ-12"]} and
+// returns the updated capture
+func patchRequestHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid request ID", http.StatusBadRequest)
+		return
+	}
+	if _, ok := requestFromPath(w, r); !ok {
+		return
+	}
+	var patch requestPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	err = store.Update(id, patch.apply)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Request not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update request", http.StatusInternalServerError)
+		return
+	}
+	getRequestHandler(w, r)
+}
+
+func deleteRequestHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid request ID", http.StatusBadRequest)
+		return
+	}
+	if _, ok := requestFromPath(w, r); !ok {
+		return
+	}
+	err = store.Delete(id)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Request not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete request", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type deleteResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+// bulkDeleteHandler deletes every request matching the list endpoint's
+// filter parameters, given in the query string or a form body. An empty
+// filter is refused; /api/v1/clear removes everything. Pinned requests are kept
+// unless include_pinned=true.
+func bulkDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	filter, err := parseFilter(r.Form)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !canReadBin(r, filter.Bin) || !inScope(r, filter.Bin) {
+		binUnauthorized(w, filter.Bin)
+		return
+	}
+	if filter.IsZero() {
+		http.Error(w, "Refusing to delete without a filter; use /api/v1/clear to remove everything", http.StatusBadRequest)
+		return
+	}
+	list, err := store.List()
+	if err != nil {
+		http.Error(w, "Failed to list requests", http.StatusInternalServerError)
+		return
+	}
+	includePinned := r.Form.Get("include_pinned") == "true"
+	deleted := 0
+	for _, info := range filter.apply(list) {
+		if info.Pinned && !includePinned {
+			continue
+		}
+		if err := store.Delete(info.ID); err != nil && !errors.Is(err, ErrNotFound) {
+			http.Error(w, "Failed to delete request", http.StatusInternalServerError)
+			return
+		}
+		deleted++
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deleteResponse{Deleted: deleted})
+}
+
+type countResponse struct {
+	Count int `json:"count"`
+}
+
+// countRequestsHandler returns {"count": n} for the requests matching the
+// list endpoint's filters, without transferring any payloads
+func countRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var n int
+	// The store's own count would take in protected bins' captures, which
+	// only the filter keeps hidden
+	if filter.IsZero() && !bins.anyProtected() {
+		n, err = store.Count()
+	} else {
+		var list []RequestInfo
+		if list, err = store.List(); err == nil {
+			n = len(filter.apply(list))
+		}
+	}
+	if err != nil {
+		http.Error(w, "Failed to count requests", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(countResponse{Count: n})
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// archiveBacklog is how many evicted requests a prune keeps, when archiving
+// fails, for the next prune to retry. Past it they're deleted unarchived, so
+// an unreachable bucket can't stop retention altogether.
+const archiveBacklog = 1000
+
+// Retention bounds how much capture history a store keeps. Zero values mean
+// unlimited. Pinned requests are never evicted and don't count towards
+// MaxRequests, which caps the whole store, or BinMaxRequests, which applies
+// to each bin separately so one busy bin can't push out another's history.
+// Bins may set their own BinMaxRequests and MaxAge, and an expired bin's
+// captures all go, pinned or not.
+type Retention struct {
+	MaxRequests    int
+	BinMaxRequests int
+	MaxAge         time.Duration
+	MaxMemory      int64
+	// Evict picks which requests go first when over MaxMemory: "oldest" or
+	// "largest"
+	Evict string
+	// DefaultTTL expires captures that don't set their own ?ttl=
+	DefaultTTL time.Duration
+
+	// Archiver, when set, receives each evicted request before it is deleted
+	Archiver Archiver
+}
+
+// forBin returns ret with b's own limits in place of the global ones
+func (ret Retention) forBin(b Bin) Retention {
+	if b.MaxRequests > 0 {
+		ret.BinMaxRequests = b.MaxRequests
+	}
+	if b.MaxAge > 0 {
+		ret.MaxAge = time.Duration(b.MaxAge)
+	}
+	return ret
+}
+
+// overLimit reports whether bin or s holds more unpinned requests, or s more
+// bytes, than the caps allow, which means a prune is due straight away
+func (ret Retention) overLimit(s Store, bin string) bool {
+	if limit := ret.forBin(bins.get(bin)).BinMaxRequests; limit > 0 {
+		if n, _ := binTotals(s, bin); n > limit {
+			return true
+		}
+	}
+	if ret.MaxRequests > 0 {
+		if n, _ := storeTotals(s); n > ret.MaxRequests {
+			return true
+		}
+	}
+	if ret.MaxMemory > 0 {
+		if n, err := s.Size(); err == nil && n > ret.MaxMemory {
+			return true
+		}
+	}
+	return false
+}
+
+// prune deletes the requests in s that fall outside ret and returns how many
+// were removed
+func (ret Retention) prune(s Store) (int, error) {
+	list, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	created := bins.all()
+	evict := make(map[int]bool)
+	var kept []RequestInfo
+	unpinned := make(map[string]int) // by bin
+	total := 0                       // kept unpinned, of every bin
+	for _, info := range list {
+		if created[info.Bin].expired(now) {
+			evict[info.ID] = true
+			continue
+		}
+		if info.Pinned {
+			kept = append(kept, info)
+			continue
+		}
+		unpinned[info.Bin]++
+		limits := ret.forBin(created[info.Bin])
+		tooMany := limits.BinMaxRequests > 0 && unpinned[info.Bin] > limits.BinMaxRequests
+		tooOld := limits.MaxAge > 0 && info.Timestamp.Before(now.Add(-limits.MaxAge))
+		expired := info.ExpiresAt != nil && !info.ExpiresAt.After(now)
+		if !tooMany && !tooOld && !expired {
+			// What every bin keeps counts towards the store's cap
+			total++
+			tooMany = ret.MaxRequests > 0 && total > ret.MaxRequests
+		}
+		if tooMany || tooOld || expired {
+			evict[info.ID] = true
+		} else {
+			kept = append(kept, info)
+		}
+	}
+	if ret.MaxMemory > 0 {
+		if err := ret.evictForMemory(s, kept, len(list), evict); err != nil {
+			return 0, err
+		}
+	}
+
+	removed, backlog, dropped := 0, 0, 0
+	var archiveErr error
+	for _, info := range list {
+		if !evict[info.ID] {
+			continue
+		}
+		if ret.Archiver != nil {
+			// After one failed upload the rest aren't tried; the bucket is
+			// most likely unreachable
+			if archiveErr == nil {
+				if err := ret.archive(s, info); err != nil {
+					archiveErr = fmt.Errorf("archive request %d: %w", info.ID, err)
+				}
+			}
+			if archiveErr != nil {
+				if backlog < archiveBacklog {
+					// Keep the request so the next prune retries the upload
+					backlog++
+					continue
+				}
+				dropped++
+			}
+		}
+		if err := s.Delete(info.ID); err != nil && err != ErrNotFound {
+			return removed, err
+		}
+		removed++
+	}
+	if dropped > 0 {
+		archiveErr = fmt.Errorf("%w; deleted %d requests unarchived, past the backlog of %d", archiveErr, dropped, archiveBacklog)
+	}
+	return removed, archiveErr
+}
+
+// pruning is set while a prune started by a webhook runs, so a burst of
+// webhooks over the caps starts only the one
+var pruning atomic.Bool
+
+// pruneSoon prunes s in the background unless a prune already is, so
+// webhooks never wait on the store scan or archive uploads
+func (ret Retention) pruneSoon(s Store) {
+	if !pruning.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer pruning.Store(false)
+		if _, err := ret.prune(s); err != nil {
+			log.Printf("Retention prune failed: %v", err)
+		}
+	}()
+}
+
+// expiry returns when a capture of r should expire: ?ttl= takes seconds or a
+// Go duration such as 5m, ttl=0 opts out of the default, and nil means never
+func (ret Retention) expiry(r *http.Request, now time.Time) *time.Time {
+	ttl := ret.DefaultTTL
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			ttl = time.Duration(secs) * time.Second
+		} else if d, err := time.ParseDuration(v); err == nil {
+			ttl = d
+		}
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	t := now.Add(ttl)
+	return &t
+}
+
+// evictForMemory marks requests from kept (newest first) for eviction until
+// the store fits in MaxMemory. Store sizes reflect the stored form, which may
+// be compressed or encrypted, so each request's share is estimated by scaling
+// its decoded size by the store's overall ratio.
+func (ret Retention) evictForMemory(s Store, kept []RequestInfo, total int, evict map[int]bool) error {
+	size, err := s.Size()
+	if err != nil || size <= ret.MaxMemory {
+		return err
+	}
+	var decoded int64
+	for _, info := range kept {
+		decoded += approxSize(info)
+	}
+	if decoded == 0 {
+		return nil
+	}
+	// Requests already evicted by count or age free their share too
+	size = size * int64(len(kept)) / int64(total)
+	ratio := float64(size) / float64(decoded)
+
+	candidates := make([]RequestInfo, len(kept))
+	copy(candidates, kept)
+	if ret.Evict == "largest" {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return approxSize(candidates[i]) > approxSize(candidates[j])
+		})
+	} else {
+		slices.Reverse(candidates)
+	}
+	for _, info := range candidates {
+		if size <= ret.MaxMemory {
+			break
+		}
+		if info.Pinned {
+			continue
+		}
+		evict[info.ID] = true
+		size -= int64(float64(approxSize(info)) * ratio)
+	}
+	return nil
+}
+
+// archive hands info, with its full body, to the configured archiver
+func (ret Retention) archive(s Store, info RequestInfo) error {
+	if info.BodyRef != "" {
+		full, err := s.Get(info.ID)
+		if err != nil {
+			return err
+		}
+		info = full
+	}
+	return ret.Archiver.Archive(info)
+}
+
+// runJanitor prunes s every interval until the process exits
+func runJanitor(s Store, ret Retention, interval time.Duration) {
+	for range time.Tick(interval) {
+		if n, err := ret.prune(s); err != nil {
+			log.Printf("Retention prune failed: %v", err)
+		} else if n > 0 {
+			log.Printf("Retention pruned %d requests", n)
+		}
+	}
+}
+
+// schedulePurge deletes requests older than window from s each time the cron
+// spec fires, e.g. "0 3 * * *" for 03:00 daily. Evicted requests still go to
+// the archiver.
+func schedulePurge(s Store, spec string, window time.Duration, archiver Archiver) error {
+	c := cron.New()
+	purge := Retention{MaxAge: window, Archiver: archiver}
+	_, err := c.AddFunc(spec, func() {
+		if n, err := purge.prune(s); err != nil {
+			log.Printf("Scheduled purge failed: %v", err)
+		} else {
+			log.Printf("Scheduled purge removed %d requests older than %s", n, window)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("invalid purge schedule %q: %w", spec, err)
+	}
+	c.Start()
+	return nil
+}
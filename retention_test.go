@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestPruneStoreAndBinCaps(t *testing.T) {
+	bins = &binRegistry{bins: map[string]Bin{}}
+	s := newTallyStore(newMemoryStore())
+	for _, bin := range []string{"a", "a", "a", "b", "c", "c"} {
+		s.Add(&RequestInfo{Bin: bin})
+	}
+	s.Add(&RequestInfo{Bin: "a", Pinned: true})
+	ret := Retention{MaxRequests: 4, BinMaxRequests: 2}
+	if !ret.overLimit(s, "a") {
+		t.Error("overLimit missed a bin over its cap")
+	}
+	if !(Retention{MaxRequests: 5}).overLimit(s, "b") {
+		t.Error("overLimit missed the store over its cap")
+	}
+	if removed, err := ret.prune(s); err != nil || removed != 2 {
+		t.Fatalf("prune removed %d, %v; want 2", removed, err)
+	}
+	kept := map[string]int{}
+	s.Each(func(info RequestInfo) error {
+		if !info.Pinned {
+			kept[info.Bin]++
+		}
+		return nil
+	})
+	// Newest first: c, c, b, a, then a over the store's cap and a over the bin's
+	if kept["a"] != 1 || kept["b"] != 1 || kept["c"] != 2 {
+		t.Errorf("kept %v, want a:1 b:1 c:2", kept)
+	}
+	if ret.overLimit(s, "a") {
+		t.Error("overLimit after a prune")
+	}
+}
+
+func TestTallySizeFollowsBackend(t *testing.T) {
+	backend := newMemoryStore()
+	s := newTallyStore(backend)
+	body := make([]byte, 1000)
+	for range 4 {
+		s.Add(&RequestInfo{Body: string(body)})
+	}
+	want, _ := backend.Size()
+	if got, _ := s.Size(); got != want {
+		t.Fatalf("Size = %d, backend's = %d", got, want)
+	}
+	for range 4 {
+		s.Add(&RequestInfo{Body: string(body)})
+	}
+	list, _ := s.List()
+	s.Delete(list[0].ID)
+	want, _ = backend.Size()
+	if got, _ := s.Size(); got < want*9/10 || got > want*11/10 {
+		t.Errorf("Size = %d after adds and a delete, backend's = %d", got, want)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// role is what a caller may do through the management API. Each role can do
+// everything the ones before it can.
+type role string
+
+const (
+	roleNone   role = "none"   // nothing but logging in
+	roleViewer role = "viewer" // read captures and stats
+	roleEditor role = "editor" // also clear, delete, annotate, import and create bins, rules and hooks
+	roleAdmin  role = "admin"  // also back up, restore and manage users
+)
+
+var roleRanks = map[role]int{roleNone: 0, roleViewer: 1, roleEditor: 2, roleAdmin: 3}
+
+func parseRole(s string) (role, error) {
+	if _, ok := roleRanks[role(s)]; !ok {
+		return "", fmt.Errorf("unknown role %q; use none, viewer, editor or admin", s)
+	}
+	return role(s), nil
+}
+
+// allows reports whether r covers need
+func (r role) allows(need role) bool {
+	return roleRanks[r] >= roleRanks[need]
+}
+
+// higher returns whichever of a and b allows more
+func higher(a, b role) role {
+	if roleRanks[b] > roleRanks[a] {
+		return b
+	}
+	return a
+}
+
+// anonymousRole is what callers who aren't logged in may do, from
+// --anonymous-role. The default keeps a single-user instance open.
+var anonymousRole = roleEditor
+
+// defaultRole is given to new accounts, from --default-role
+var defaultRole = roleEditor
+
+// role returns what u may do; accounts saved before roles existed get
+// defaultRole
+func (u User) role() role {
+	if u.Role == "" {
+		return defaultRole
+	}
+	return u.Role
+}
+
+// bootstrapAdmin makes the account username, from --admin-user, an admin,
+// creating it with password if it doesn't exist. No account becomes an admin
+// otherwise, so whoever signs up first on a new instance can't take it over.
+func (r *userRegistry) bootstrapAdmin(username, password string) error {
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("invalid username %q", username)
+	}
+	r.mu.Lock()
+	i := slices.IndexFunc(r.users, func(u User) bool { return strings.EqualFold(u.Username, username) })
+	if i >= 0 {
+		r.users[i].Role = roleAdmin
+		err := r.save()
+		r.mu.Unlock()
+		return err
+	}
+	r.mu.Unlock()
+	if len(password) < 8 || len(password) > 72 {
+		return errors.New("creating the account needs an --admin-password of 8 to 72 bytes")
+	}
+	_, err := r.add(username, password, roleAdmin)
+	return err
+}
+
+// routeRole is the least role rt needs: reads need a viewer, changes an
+// editor
+func routeRole(rt apiRoute) role {
+	switch {
+	case rt.Public:
+		return roleNone
+	case rt.Admin:
+		return roleAdmin
+	case rt.Method == http.MethodGet || rt.Method == http.MethodHead:
+		return roleViewer
+	}
+	return roleEditor
+}
+
+// callerRole returns what r may do by the admin token, its login or, failing
+// those, --anonymous-role
+func callerRole(r *http.Request) role {
+	if isAdminToken(bearerToken(r)) {
+		return roleAdmin
+	}
+	if u, ok := sessionUser(r); ok {
+		return higher(u.role(), anonymousRole)
+	}
+	return anonymousRole
+}
+
+// binScope is what a role granted by bin credentials reaches: the bin, and
+// for a capture's share link that one capture
+type binScope struct {
+	Bin       string
+	RequestID int
+}
+
+// binScopeKey is the context key of the binScope a request was let in on
+type binScopeKey struct{}
+
+// scopeOf returns the scope r was let in on, if bin credentials were all it
+// had
+func scopeOf(r *http.Request) (binScope, bool) {
+	scope, ok := r.Context().Value(binScopeKey{}).(binScope)
+	return scope, ok
+}
+
+// inScope reports whether r may act on bin: always for callers with a role of
+// their own, and only on their bin for those let in by its credentials
+func inScope(r *http.Request, bin string) bool {
+	scope, ok := scopeOf(r)
+	return !ok || scope.RequestID == 0 && scope.Bin == bin
+}
+
+// captureInScope reports whether r may see info: always for callers with a
+// role of their own, and only within their bin or capture for the others
+func captureInScope(r *http.Request, info RequestInfo) bool {
+	scope, ok := scopeOf(r)
+	return !ok || info.Bin == scope.Bin && (scope.RequestID == 0 || scope.RequestID == info.ID)
+}
+
+// binRole returns what r may do by credentials for a protected bin alone,
+// and where: a request scoped to the bin, by ?bin= or its path, with its
+// read token, password or owner's login may change it, and a share link may
+// read it or its one capture
+func binRole(r *http.Request) (role, binScope) {
+	q := r.URL.Query()
+	bin := q.Get("bin")
+	if bin == "" {
+		bin = r.PathValue("token")
+	}
+	if bins.protected(bin) && hasBinCredentials(r, bins.get(bin)) {
+		return roleEditor, binScope{Bin: bin}
+	}
+	if q.Get("share") == "" {
+		return roleNone, binScope{}
+	}
+	if share, ok := presentedShare(r, bins.get(bin)); ok {
+		return roleViewer, binScope{Bin: bin, RequestID: share.RequestID}
+	}
+	if bin == "" {
+		// A capture's link names no bin
+		for token, b := range bins.all() {
+			if share, ok := presentedShare(r, b); ok {
+				return roleViewer, binScope{Bin: token, RequestID: share.RequestID}
+			}
+		}
+	}
+	return roleNone, binScope{}
+}
+
+// withBinScope returns r confined to scope: list and filter endpoints see
+// only the bin, and a capture's link reaches nothing but that capture. It
+// reports false when r asks for something else.
+func withBinScope(r *http.Request, scope binScope) (*http.Request, bool) {
+	if token := r.PathValue("token"); token != "" && token != scope.Bin {
+		return r, false
+	}
+	if scope.RequestID != 0 {
+		if r.PathValue("id") != strconv.Itoa(scope.RequestID) {
+			return r, false
+		}
+	} else if r.URL.Query().Get("bin") == "" && r.PathValue("token") == "" {
+		u := *r.URL
+		q := u.Query()
+		q.Set("bin", scope.Bin)
+		u.RawQuery = q.Encode()
+		r = r.Clone(r.Context())
+		r.URL = &u
+	}
+	return r.WithContext(context.WithValue(r.Context(), binScopeKey{}, scope)), true
+}
+
+// setRole changes the role of account id
+func (r *userRegistry) setRole(id int, ro role) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.users, func(u User) bool { return u.ID == id })
+	if i < 0 {
+		return User{}, ErrNotFound
+	}
+	r.users[i].Role = ro
+	return r.users[i], r.save()
+}
+
+func (r *userRegistry) list() []User {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]User, len(r.users))
+	for i, u := range r.users {
+		u.Role = u.role()
+		list[i] = u.redacted()
+	}
+	return list
+}
+
+// listUsersHandler returns every account with its role
+func listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users.list())
+}
+
+// userPatch is the body accepted when changing an account
+type userPatch struct {
+	Role role `json:"role"`
+}
+
+// patchUserHandler changes an account's role from {"role": "viewer"}
+func patchUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	var patch userPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	ro, err := parseRole(string(patch.Role))
+	if err != nil {
+		http.Error(w, "Invalid role: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	u, err := users.setRole(id, ro)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to save user", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u.redacted())
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestBinCredentialsStayInTheirBin(t *testing.T) {
+	srv := newTestServer(t)
+	bin, readToken := createProtectedBin(t, srv)
+	anonymousRole = roleNone
+	send(t, srv, "POST", "/b/"+bin+"/hook", "mine")
+	send(t, srv, "POST", "/b/open/hook", "theirs")
+	var open RequestInfo
+	store.Each(func(info RequestInfo) error {
+		if info.Bin == "open" {
+			open = info
+		}
+		return nil
+	})
+	token := "read_token=" + readToken
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"no role", "GET", "/api/v1/requests", "", http.StatusUnauthorized},
+		{"own bin", "GET", "/api/v1/requests?bin=" + bin + "&" + token, "", http.StatusOK},
+		{"another bin", "GET", "/api/v1/requests?bin=open&" + token, "", http.StatusUnauthorized},
+		{"another bin's capture", "GET", "/api/v1/requests/" + strconv.Itoa(open.ID) + "?bin=" + bin + "&" + token, "", http.StatusNotFound},
+		{"deleting another bin's capture", "DELETE", "/api/v1/requests/" + strconv.Itoa(open.ID) + "?bin=" + bin + "&" + token, "", http.StatusNotFound},
+		{"rule for every bin", "POST", "/api/v1/rules?bin=" + bin + "&" + token, `{"response": {"status": 202}}`, http.StatusUnauthorized},
+		{"rule for own bin", "POST", "/api/v1/rules?bin=" + bin + "&" + token, `{"bin": "` + bin + `", "response": {"status": 202}}`, http.StatusCreated},
+		{"creating a bin", "POST", "/api/v1/bins?" + token, "", http.StatusUnauthorized},
+		{"admin routes", "GET", "/api/v1/users?bin=" + bin + "&" + token, "", http.StatusUnauthorized},
+		{"clearing own bin", "POST", "/api/v1/clear?bin=" + bin + "&" + token, "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if status, body := send(t, srv, tt.method, tt.path, tt.body); status != tt.status {
+			t.Errorf("%s: %s %s = %d, want %d: %s", tt.name, tt.method, tt.path, status, tt.status, body)
+		}
+	}
+	if _, err := store.Get(open.ID); err != nil {
+		t.Errorf("the other bin's capture is gone: %v", err)
+	}
+}
+
+func TestViewerCannotChange(t *testing.T) {
+	srv := newTestServer(t)
+	anonymousRole = roleViewer
+	send(t, srv, "POST", "/hook", "x")
+	if status, _ := send(t, srv, "GET", "/api/v1/requests", ""); status != http.StatusOK {
+		t.Errorf("viewer listing = %d", status)
+	}
+	for _, path := range []string{"/api/v1/clear", "/api/v1/requests/delete", "/api/v1/rules"} {
+		if status, _ := send(t, srv, "POST", path, "{}"); status != http.StatusUnauthorized {
+			t.Errorf("viewer POST %s = %d, want 401", path, status)
+		}
+	}
+}
+
+func TestWebSocketFilterStaysInScope(t *testing.T) {
+	srv := newTestServer(t)
+	bin, readToken := createProtectedBin(t, srv)
+	anonymousRole = roleNone
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v1/ws?bin=" + bin + "&read_token=" + readToken
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if err := conn.WriteJSON(wsFilterMessage{Type: "filter", Query: "bin=open"}); err != nil {
+		t.Fatal(err)
+	}
+	var reply wsError
+	if err := conn.ReadJSON(&reply); err != nil || reply.Type != "error" {
+		t.Fatalf("switching to another bin = %+v, %v; want an error", reply, err)
+	}
+	send(t, srv, "POST", "/b/open/hook", "theirs")
+	send(t, srv, "POST", "/b/"+bin+"/hook", "mine")
+	var ev struct {
+		Type    string       `json:"type"`
+		Request *RequestInfo `json:"request"`
+	}
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &ev); err != nil || ev.Request == nil || ev.Request.Bin != bin {
+		t.Errorf("first event = %s, want the capture to %s", data, bin)
+	}
+}
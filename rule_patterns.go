@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// How a rule's path and header values are compared with the request's
+const (
+	matchExact = "exact"
+	matchGlob  = "glob"
+	matchRegex = "regex"
+)
+
+// ruleGroups is what a rule's pattern groups caught, by number and by name
+type ruleGroups map[string]string
+
+// rulePatterns caches compiled rule patterns by kind, place and text
+var rulePatterns sync.Map
+
+// rulePattern compiles pattern, of the kind rule.Match names, into a regexp
+// matching the whole of a path, or of a header value when path is false
+func rulePattern(kind, pattern string, path bool) (*regexp.Regexp, error) {
+	key := fmt.Sprintf("%s %t %s", kind, path, pattern)
+	if re, ok := rulePatterns.Load(key); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	expr := pattern
+	if kind == matchGlob {
+		expr = globRegexp(pattern, path)
+	}
+	re, err := regexp.Compile(`^(?:` + expr + `)$`)
+	if err != nil {
+		return nil, err
+	}
+	rulePatterns.Store(key, re)
+	return re, nil
+}
+
+// globRegexp turns a glob into a regexp with a group for each wildcard. In
+// paths * and ? stay within a segment and ** crosses them, so /orders/*
+// matches /orders/42 but not /orders/42/items; in header values * is
+// anything.
+func globRegexp(glob string, path bool) string {
+	star, one := `(.*)`, `(.)`
+	if path {
+		star, one = `([^/]*)`, `([^/])`
+	}
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(`(.*)`)
+			i++
+		case glob[i] == '*':
+			b.WriteString(star)
+		case glob[i] == '?':
+			b.WriteString(one)
+		default:
+			j := strings.IndexAny(glob[i:], "*?")
+			if j < 0 {
+				j = len(glob) - i
+			}
+			b.WriteString(regexp.QuoteMeta(glob[i : i+j]))
+			i += j - 1
+		}
+	}
+	return b.String()
+}
+
+// validatePatterns checks rule's path and header patterns compile
+func (rule Rule) validatePatterns() error {
+	switch rule.Match {
+	case "", matchExact:
+		return nil
+	case matchGlob, matchRegex:
+	default:
+		return fmt.Errorf("match %q is not exact, glob or regex", rule.Match)
+	}
+	if rule.Path != "" {
+		if _, err := rulePattern(rule.Match, rule.Path, true); err != nil {
+			return fmt.Errorf("path: %w", err)
+		}
+	}
+	for k, v := range rule.Headers {
+		if _, err := rulePattern(rule.Match, v, false); err != nil {
+			return fmt.Errorf("header %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// matchValue compares value with want, the rule's path when path is set or
+// else a header value, adding what its groups caught to captures under
+// prefix followed by their number, and under their name
+func (rule Rule) matchValue(want, value string, path bool, prefix string, captures ruleGroups) bool {
+	if rule.Match == "" || rule.Match == matchExact {
+		return want == value
+	}
+	re, err := rulePattern(rule.Match, want, path)
+	if err != nil {
+		// Rules are validated before they're kept
+		return false
+	}
+	m := re.FindStringSubmatch(value)
+	if m == nil {
+		return false
+	}
+	for i, name := range re.SubexpNames()[1:] {
+		captures[prefix+strconv.Itoa(i+1)] = m[i+1]
+		if name != "" {
+			captures[name] = m[i+1]
+		}
+	}
+	return true
+}
+
+// matchHeader reports whether any of r's values for the header name matches
+// want, catching the groups of the first that does
+func (rule Rule) matchHeader(r *http.Request, name, want string, captures ruleGroups) bool {
+	for _, v := range r.Header.Values(name) {
+		if rule.matchValue(want, v, false, http.CanonicalHeaderKey(name)+".", captures) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"maps"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		glob string
+		path bool
+		want string
+	}{
+		{"/orders", true, `/orders`},
+		{"/orders/*", true, `/orders/([^/]*)`},
+		{"/orders/**", true, `/orders/(.*)`},
+		{"/v?/orders", true, `/v([^/])/orders`},
+		{"/a.b/*/c+", true, `/a\.b/([^/]*)/c\+`},
+		{"Bearer *", false, `Bearer (.*)`},
+		{"v?", false, `v(.)`},
+	}
+	for _, tt := range tests {
+		if got := globRegexp(tt.glob, tt.path); got != tt.want {
+			t.Errorf("globRegexp(%q, %t) = %q, want %q", tt.glob, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMatchValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		match  string
+		want   string
+		value  string
+		path   bool
+		ok     bool
+		groups ruleGroups
+	}{
+		{"exact", "", "/orders", "/orders", true, true, ruleGroups{}},
+		{"exact differs", matchExact, "/orders", "/orders/1", true, false, ruleGroups{}},
+		{"glob segment", matchGlob, "/orders/*", "/orders/42", true, true, ruleGroups{"1": "42"}},
+		{"glob stays in segment", matchGlob, "/orders/*", "/orders/42/items", true, false, ruleGroups{}},
+		{"glob crosses segments", matchGlob, "/files/**", "/files/a/b.txt", true, true, ruleGroups{"1": "a/b.txt"}},
+		{"glob groups in order", matchGlob, "/*/orders/?", "/eu/orders/7", true, true, ruleGroups{"1": "eu", "2": "7"}},
+		{"glob header", matchGlob, "Bearer *", "Bearer a/b", false, true, ruleGroups{"1": "a/b"}},
+		{"regex named", matchRegex, `/orders/(?P<id>\d+)`, "/orders/42", true, true, ruleGroups{"1": "42", "id": "42"}},
+		{"regex whole value", matchRegex, `/orders/\d+`, "/orders/42/items", true, false, ruleGroups{}},
+		{"regex no match", matchRegex, `/orders/(\d+)`, "/orders/x", true, false, ruleGroups{}},
+	}
+	for _, tt := range tests {
+		rule := Rule{Match: tt.match}
+		groups := ruleGroups{}
+		ok := rule.matchValue(tt.want, tt.value, tt.path, "", groups)
+		if ok != tt.ok || !maps.Equal(groups, tt.groups) {
+			t.Errorf("%s: matchValue(%q, %q) = %t, %v; want %t, %v", tt.name, tt.want, tt.value, ok, groups, tt.ok, tt.groups)
+		}
+	}
+}
+
+func TestMatchHeaderGroups(t *testing.T) {
+	r := httptest.NewRequest("POST", "/hook", nil)
+	r.Header.Add("x-id", "other")
+	r.Header.Add("x-id", "order-42")
+	rule := Rule{Match: matchGlob}
+	groups := ruleGroups{}
+	if !rule.matchHeader(r, "x-id", "order-*", groups) {
+		t.Fatal("matchHeader didn't match the second value")
+	}
+	if want := (ruleGroups{"X-Id.1": "42"}); !maps.Equal(groups, want) {
+		t.Errorf("groups = %v, want %v", groups, want)
+	}
+}
+
+func TestReplyRenderMatchGroups(t *testing.T) {
+	rep := Reply{Headers: map[string]string{"X-Order": "{{match 1}}-{{match \"id\"}}"}, Body: "{{match \"missing\"}}", Template: true}
+	got, err := rep.render(RequestInfo{RuleGroups: ruleGroups{"1": "orders", "id": "9"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Headers["X-Order"] != "orders-9" || got.Body != "" {
+		t.Errorf("render = %+v, want X-Order orders-9 and an empty body", got)
+	}
+}
+
+func TestValidatePatterns(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		ok   bool
+	}{
+		{Rule{Path: "/orders/(", Match: matchExact}, true},
+		{Rule{Path: "/orders/*", Match: matchGlob}, true},
+		{Rule{Path: "/orders/(", Match: matchRegex}, false},
+		{Rule{Headers: map[string]string{"X-Id": "[a-"}, Match: matchRegex}, false},
+		{Rule{Path: "/orders", Match: "prefix"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.rule.validatePatterns(); (err == nil) != tt.ok {
+			t.Errorf("validatePatterns(%+v) = %v, want ok %t", tt.rule, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// maxRuleDelay caps Rule.Delay so a mock can't hold connections forever
+const maxRuleDelay = time.Minute
+
+// Rule answers the webhooks it matches with a canned response in place of
+// the bin's, turning webhook-host into a mock of the real receiver. Rules
+// are tried in order of ID, and the first match wins; every webhook is
+// still captured.
+type Rule struct {
+	ID   int    `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Bin limits the rule to one bin. Rules for every bin, which only admins
+	// may set, leave protected bins alone.
+	Bin    string `json:"bin,omitempty"`
+	Method string `json:"method,omitempty"` // any method when empty
+	// Path is matched against the path below the bin, such as /orders for
+	// /b/{token}/orders, or the whole path outside bins
+	Path string `json:"path,omitempty"`
+	// Headers must all be present with these values
+	Headers map[string]string `json:"headers,omitempty"`
+	// Match makes Path and the header values globs, such as /orders/*, or
+	// regular expressions, such as /orders/(?P<id>\d+), matching the whole
+	// value. What their groups catch is {{match 1}} or {{match "id"}} in a
+	// templated response; header groups are numbered as {{match "X-Id.1"}}.
+	Match     string    `json:"match,omitempty"` // exact, the default, glob or regex
+	Response  Reply     `json:"response"`
+	Delay     duration  `json:"delay,omitempty"` // held before answering, at most a minute
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// validate reports what's wrong with a rule from the API or rules file
+func (rule Rule) validate() error {
+	if rule.Method != "" && !httpguts.ValidHeaderFieldName(rule.Method) {
+		return fmt.Errorf("invalid method %q", rule.Method)
+	}
+	if rule.Path != "" && rule.Match != matchRegex && !strings.HasPrefix(rule.Path, "/") {
+		return fmt.Errorf("path %q doesn't start with /", rule.Path)
+	}
+	for k := range rule.Headers {
+		if !httpguts.ValidHeaderFieldName(k) {
+			return fmt.Errorf("invalid header name %q", k)
+		}
+	}
+	if rule.Delay < 0 || time.Duration(rule.Delay) > maxRuleDelay {
+		return fmt.Errorf("delay %s is not between 0 and %s", time.Duration(rule.Delay), maxRuleDelay)
+	}
+	if err := rule.validatePatterns(); err != nil {
+		return err
+	}
+	if err := rule.Response.validate(); err != nil {
+		return fmt.Errorf("response: %w", err)
+	}
+	return nil
+}
+
+// matches reports whether rule applies to r, sent to bin with path below it,
+// and what its patterns' groups caught
+func (rule Rule) matches(r *http.Request, bin, path string) (ruleGroups, bool) {
+	if rule.Bin != "" && rule.Bin != bin || rule.Bin == "" && bins.protected(bin) {
+		return nil, false
+	}
+	if rule.Method != "" && !strings.EqualFold(rule.Method, r.Method) {
+		return nil, false
+	}
+	captures := ruleGroups{}
+	if rule.Path != "" && !rule.matchValue(rule.Path, path, true, "", captures) {
+		return nil, false
+	}
+	for k, v := range rule.Headers {
+		if !rule.matchHeader(r, k, v, captures) {
+			return nil, false
+		}
+	}
+	return captures, true
+}
+
+// ruleRegistry holds the rules, and keeps them in a JSON file when a path is
+// set
+type ruleRegistry struct {
+	mu     sync.Mutex
+	path   string
+	nextID int
+	rules  []Rule
+}
+
+var rules = &ruleRegistry{nextID: 1}
+
+// loadRules reads the rules saved at path, if any, which may also be
+// written by hand. An empty path keeps rules in memory only.
+func loadRules(path string) error {
+	r := rules
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.path = path
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &r.rules); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for i, rule := range r.rules {
+		if rule.ID == 0 {
+			// Hand-written rules may leave IDs out; they go in file order
+			r.rules[i].ID = r.nextID
+		}
+		if err := r.rules[i].validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", r.rules[i].ID, err)
+		}
+		r.nextID = max(r.nextID, r.rules[i].ID+1)
+	}
+	slices.SortStableFunc(r.rules, func(a, b Rule) int { return a.ID - b.ID })
+	return nil
+}
+
+// save writes the rules to r.path; callers hold r.mu
+func (r *ruleRegistry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// match returns the first rule applying to r, sent to bin with path below
+// it, and what its patterns caught
+func (r *ruleRegistry) match(req *http.Request, bin, path string) (Rule, ruleGroups, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rule := range r.rules {
+		if captures, ok := rule.matches(req, bin, path); ok {
+			return rule, captures, true
+		}
+	}
+	return Rule{}, nil, false
+}
+
+func (r *ruleRegistry) add(rule Rule) (Rule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rule.ID = r.nextID
+	rule.CreatedAt = time.Now()
+	r.nextID++
+	r.rules = append(r.rules, rule)
+	return rule, r.save()
+}
+
+func (r *ruleRegistry) get(id int) (Rule, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.rules, func(rule Rule) bool { return rule.ID == id })
+	if i < 0 {
+		return Rule{}, false
+	}
+	return r.rules[i], true
+}
+
+// replace swaps in rule for the rule of the same ID, keeping its creation time
+func (r *ruleRegistry) replace(rule Rule) (Rule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.rules, func(old Rule) bool { return old.ID == rule.ID })
+	if i < 0 {
+		return Rule{}, ErrNotFound
+	}
+	rule.CreatedAt = r.rules[i].CreatedAt
+	r.rules[i] = rule
+	return rule, r.save()
+}
+
+func (r *ruleRegistry) remove(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.rules, func(rule Rule) bool { return rule.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.rules = slices.Delete(r.rules, i, i+1)
+	return r.save()
+}
+
+func (r *ruleRegistry) list() []Rule {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.rules)
+}
+
+// pathInBin returns r's path below the bin it was sent to, token
+func pathInBin(r *http.Request, token string) string {
+	path, ok := strings.CutPrefix(r.URL.Path, "/b/"+token)
+	if token == "" || !ok || hostBin(r.Host) != "" {
+		return r.URL.Path
+	}
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// holdReply holds the answer to r for d, unless the client gives up first
+func holdReply(r *http.Request, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-r.Context().Done():
+	}
+}
+
+// listRulesHandler returns the rules in the order they're tried, leaving out
+// those of protected bins the caller can't read, and those of other bins
+// when it only holds one bin's credentials
+func listRulesHandler(w http.ResponseWriter, r *http.Request) {
+	list := []Rule{}
+	for _, rule := range rules.list() {
+		if canReadBin(r, rule.Bin) && inScope(r, rule.Bin) {
+			list = append(list, rule)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// ruleFromPath looks up the rule named by the {id} path value, writing an
+// error response and returning false when it can't be found or read
+func ruleFromPath(w http.ResponseWriter, r *http.Request) (Rule, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+		return Rule{}, false
+	}
+	rule, ok := rules.get(id)
+	if !ok || !canReadBin(r, rule.Bin) || !inScope(r, rule.Bin) {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return Rule{}, false
+	}
+	return rule, true
+}
+
+func getRuleHandler(w http.ResponseWriter, r *http.Request) {
+	rule, ok := ruleFromPath(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+// mayChangeRules reports whether r may add, change or remove rules for bin,
+// writing a 403 when it may not. Rules for every bin answer for every open
+// bin, so they're left to admins.
+func mayChangeRules(w http.ResponseWriter, r *http.Request, bin string) bool {
+	if bin == "" && callerRole(r) != roleAdmin {
+		http.Error(w, "Forbidden; rules for every bin need the admin role", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// decodeRule reads a rule from r's body, checking it and that the caller
+// may set rules for its bin
+func decodeRule(w http.ResponseWriter, r *http.Request) (Rule, bool) {
+	var rule Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return Rule{}, false
+	}
+	if err := rule.validate(); err != nil {
+		http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+		return Rule{}, false
+	}
+	if !canReadBin(r, rule.Bin) || !inScope(r, rule.Bin) {
+		binUnauthorized(w, rule.Bin)
+		return Rule{}, false
+	}
+	if !mayChangeRules(w, r, rule.Bin) {
+		return Rule{}, false
+	}
+	return rule, true
+}
+
+// createRuleHandler adds a rule from a body such as {"method": "POST",
+// "path": "/orders", "response": {"status": 201, "body": "{\"id\": 1}"}},
+// tried after the existing ones
+func createRuleHandler(w http.ResponseWriter, r *http.Request) {
+	rule, ok := decodeRule(w, r)
+	if !ok {
+		return
+	}
+	rule, err := rules.add(rule)
+	if err != nil {
+		http.Error(w, "Failed to save rule", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+// updateRuleHandler replaces a rule, keeping its ID and place in the order
+func updateRuleHandler(w http.ResponseWriter, r *http.Request) {
+	old, ok := ruleFromPath(w, r)
+	if !ok || !mayChangeRules(w, r, old.Bin) {
+		return
+	}
+	rule, ok := decodeRule(w, r)
+	if !ok {
+		return
+	}
+	rule.ID = old.ID
+	rule, err := rules.replace(rule)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to save rule", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+func deleteRuleHandler(w http.ResponseWriter, r *http.Request) {
+	rule, ok := ruleFromPath(w, r)
+	if !ok || !mayChangeRules(w, r, rule.Bin) {
+		return
+	}
+	err := rules.remove(rule.ID)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to save rules", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
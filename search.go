@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// searchFields are the parts of a capture /api/v1/search can look in
+var searchFields = []string{"body", "headers", "url"}
+
+// searchHandler finds captures whose body, headers or URL contain ?q=.
+// Matching is a case-insensitive substring unless regex=true, and fields=
+// narrows where to look (comma separated, default all). The list endpoint's
+// filter and paging parameters apply as well.
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	term := q.Get("q")
+	if term == "" {
+		http.Error(w, "Missing q parameter", http.StatusBadRequest)
+		return
+	}
+
+	var match func(string) bool
+	if q.Get("regex") == "true" {
+		re, err := regexp.Compile(term)
+		if err != nil {
+			http.Error(w, "Invalid regex: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		match = re.MatchString
+	} else {
+		lower := strings.ToLower(term)
+		match = func(s string) bool { return strings.Contains(strings.ToLower(s), lower) }
+	}
+
+	fields := searchFields
+	if v := q.Get("fields"); v != "" {
+		fields = strings.Split(v, ",")
+		for _, f := range fields {
+			if !slices.Contains(searchFields, f) {
+				http.Error(w, "Unknown search field "+f, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	list, pg, ok := filteredRequests(w, r)
+	if !ok {
+		return
+	}
+	// Search spilled bodies in full, not just their previews
+	if err := hydrateBodies(list); err != nil {
+		http.Error(w, "Failed to load request body", http.StatusInternalServerError)
+		return
+	}
+	hits := list[:0]
+	for _, info := range list {
+		if searchMatch(info, fields, match) {
+			hits = append(hits, info)
+		}
+	}
+	writeRequestPage(w, r, hits, pg)
+}
+
+func searchMatch(info RequestInfo, fields []string, match func(string) bool) bool {
+	for _, f := range fields {
+		switch f {
+		case "body":
+			if match(info.Body) {
+				return true
+			}
+		case "url":
+			if match(info.URL) {
+				return true
+			}
+		case "headers":
+			for k, values := range info.Headers {
+				for _, v := range values {
+					if match(k + ": " + v) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
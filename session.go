@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sessionCookie carries the signed session of a logged-in user
+const sessionCookie = "webhook_host_session"
+
+// ownCookies masks the session and login cookies in captures, for a browser
+// logged in here that visits a bin's URL would otherwise hand its login to
+// everyone who can read the bin
+var ownCookies = &redactRules{cookies: []string{sessionCookie, oauthCookie}}
+
+// sessionTTL is how long a login lasts
+const sessionTTL = 7 * 24 * time.Hour
+
+// sessionKey signs sessions, set from --session-key. Without one a random
+// key is made at startup, so restarting logs everyone out.
+var sessionKey []byte
+
+func initSessionKey(key string) error {
+	if key != "" {
+		sessionKey = []byte(key)
+		return nil
+	}
+	sessionKey = make([]byte, 32)
+	_, err := rand.Read(sessionKey)
+	return err
+}
+
+// signSession returns a token naming user until expires, signed so it
+// needs no server-side state
+func signSession(user int, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d.%d", user, expires.Unix()))
+	return payload + "." + sessionMAC(payload)
+}
+
+func sessionMAC(payload string) string {
+	mac := hmac.New(sha256.New, sessionKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseSession returns the user a token from signSession names, if its
+// signature holds and it hasn't expired
+func parseSession(token string, now time.Time) (int, bool) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(sessionMAC(payload))) {
+		return 0, false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return 0, false
+	}
+	var user int
+	var expires int64
+	if _, err := fmt.Sscanf(string(data), "%d.%d", &user, &expires); err != nil || now.Unix() >= expires {
+		return 0, false
+	}
+	return user, true
+}
+
+// startSession logs user in on w with a session cookie, returning the same
+// token for use as a bearer token by API clients. The cookie is only sent to
+// the API, not to the bins sharing its origin.
+func startSession(w http.ResponseWriter, r *http.Request, user int) string {
+	expires := time.Now().Add(sessionTTL)
+	token := signSession(user, expires)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     apiPrefix,
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token
+}
+
+// endSession drops the session cookie, including one set for every path
+// before it was kept to the API
+func endSession(w http.ResponseWriter) {
+	for _, path := range []string{apiPrefix, "/"} {
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: path, MaxAge: -1, HttpOnly: true})
+	}
+}
+
+// sessionUser returns the logged-in user r carries, by session cookie or
+// as a bearer token
+func sessionUser(r *http.Request) (User, bool) {
+	tokens := []string{bearerToken(r)}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		tokens = append(tokens, c.Value)
+	}
+	for _, token := range tokens {
+		if id, ok := parseSession(token, time.Now()); ok {
+			return users.get(id)
+		}
+	}
+	return User{}, false
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// defaultShareTTL is how long a share link lasts without an expires_in
+const defaultShareTTL = 24 * time.Hour
+
+// Share is a read-only link to a protected bin, or to one capture in it. It
+// only works for GETs, so it can't clear, delete or annotate anything.
+type Share struct {
+	Token     string    `json:"token"`
+	RequestID int       `json:"request_id,omitempty"` // the one capture shared, or 0 for the whole bin
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// addShare records s on bin, dropping the bin's expired shares
+func (r *binRegistry) addShare(bin string, s Share) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.bins[bin]
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now()
+	b.Shares = append(slices.DeleteFunc(slices.Clone(b.Shares), func(s Share) bool {
+		return !s.ExpiresAt.After(now)
+	}), s)
+	r.bins[bin] = b
+	return r.save()
+}
+
+// presentedShare returns the unexpired share of b that r carries in ?share=
+func presentedShare(r *http.Request, b Bin) (Share, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return Share{}, false
+	}
+	token := r.URL.Query().Get("share")
+	if token == "" {
+		return Share{}, false
+	}
+	now := time.Now()
+	for _, s := range b.Shares {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1 && s.ExpiresAt.After(now) {
+			return s, true
+		}
+	}
+	return Share{}, false
+}
+
+// canReadCapture reports whether r may see info, through access to its bin
+// or a share link for info alone
+func canReadCapture(r *http.Request, info RequestInfo) bool {
+	if canReadBin(r, info.Bin) {
+		return true
+	}
+	share, ok := presentedShare(r, bins.get(info.Bin))
+	return ok && share.RequestID == info.ID
+}
+
+// shareInput is the body accepted when creating a share link
+type shareInput struct {
+	// Bin is the bin to share, or RequestID the one capture; the request
+	// needs the bin's read token or password either way
+	Bin       string `json:"bin"`
+	RequestID int    `json:"request_id"`
+	ExpiresIn string `json:"expires_in"` // a Go duration, default 24h
+}
+
+// shareResponse describes a new share link
+type shareResponse struct {
+	Share
+	Bin    string `json:"bin"`
+	URL    string `json:"url"`     // the UI, opened on the shared bin or capture
+	APIURL string `json:"api_url"` // the capture list or capture as JSON
+}
+
+// createShareHandler mints a read-only, time-limited link from a body such
+// as {"request_id": 42, "expires_in": "2h"}, for handing one interesting
+// webhook to a colleague without the rights the read token carries
+func createShareHandler(w http.ResponseWriter, r *http.Request) {
+	var in shareInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	ttl, ok := positiveDuration(w, "expires_in", in.ExpiresIn)
+	if !ok {
+		return
+	}
+	if ttl == 0 {
+		ttl = defaultShareTTL
+	}
+	bin := in.Bin
+	if in.RequestID != 0 {
+		info, ok := requestByID(w, r, fmt.Sprint(in.RequestID))
+		if !ok {
+			return
+		}
+		if bin != "" && bin != info.Bin {
+			http.Error(w, "Request is not in that bin", http.StatusBadRequest)
+			return
+		}
+		bin = info.Bin
+	}
+	b := bins.get(bin)
+	if b.ReadToken == "" {
+		http.Error(w, "Only created bins need share links; their captures are otherwise readable by anyone", http.StatusBadRequest)
+		return
+	}
+	if !hasBinCredentials(r, b) {
+		binUnauthorized(w, bin)
+		return
+	}
+	token, err := newBinToken()
+	if err != nil {
+		http.Error(w, "Failed to create share", http.StatusInternalServerError)
+		return
+	}
+	share := Share{Token: token, RequestID: in.RequestID, ExpiresAt: time.Now().Add(ttl)}
+	if err := bins.addShare(bin, share); err != nil {
+		http.Error(w, "Failed to save share", http.StatusInternalServerError)
+		return
+	}
+	base := requestBase(r)
+	q := url.Values{"bin": {bin}, "share": {token}}.Encode()
+	resp := shareResponse{Share: share, Bin: bin,
+		URL:    base + "/ui/?" + q,
+		APIURL: base + apiPrefix + "/requests?" + q,
+	}
+	if share.RequestID != 0 {
+		resp.URL += fmt.Sprintf("#%d", share.RequestID)
+		resp.APIURL = fmt.Sprintf("%s%s/requests/%d?%s", base, apiPrefix, share.RequestID, url.Values{"share": {token}}.Encode())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// Sink receives copies of captured requests in batches. Sinks run off the
+// request path, so a slow or failing sink never delays a webhook response.
+type Sink interface {
+	WriteBatch(batch []RequestInfo) error
+}
+
+const (
+	sinkQueueSize     = 10000
+	sinkBatchSize     = 500
+	sinkFlushInterval = 2 * time.Second
+)
+
+type sinkQueue struct {
+	name string
+	sink Sink
+	ch   chan RequestInfo
+}
+
+var sinks []*sinkQueue
+
+// addSink registers s and starts its delivery goroutine
+func addSink(name string, s Sink) {
+	q := &sinkQueue{name: name, sink: s, ch: make(chan RequestInfo, sinkQueueSize)}
+	sinks = append(sinks, q)
+	go q.run()
+}
+
+// publishToSinks queues info for every sink, dropping it for sinks whose
+// queue is full rather than blocking the capture
+func publishToSinks(info RequestInfo) {
+	for _, q := range sinks {
+		select {
+		case q.ch <- info:
+		default:
+			log.Printf("Sink %s queue full, dropping request %d", q.name, info.ID)
+		}
+	}
+}
+
+func (q *sinkQueue) run() {
+	ticker := time.NewTicker(sinkFlushInterval)
+	defer ticker.Stop()
+	var batch []RequestInfo
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := q.sink.WriteBatch(batch); err != nil {
+			log.Printf("Sink %s failed to write %d requests: %v", q.name, len(batch), err)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case info := <-q.ch:
+			batch = append(batch, info)
+			if len(batch) >= sinkBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
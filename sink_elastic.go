@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// elasticSink indexes captures into Elasticsearch or OpenSearch through the
+// bulk API, one index per day (prefix-YYYY.MM.DD) to suit Kibana index patterns
+type elasticSink struct {
+	url    string
+	index  string
+	apiKey string
+	client *http.Client
+}
+
+func newElasticSink(url, index, apiKey string) *elasticSink {
+	return &elasticSink{
+		url:    strings.TrimSuffix(url, "/"),
+		index:  index,
+		apiKey: apiKey,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *elasticSink) WriteBatch(batch []RequestInfo) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, info := range batch {
+		action := map[string]map[string]string{
+			"index": {"_index": s.index + "-" + info.Timestamp.UTC().Format("2006.01.02")},
+		}
+		if err := enc.Encode(action); err != nil {
+			return err
+		}
+		if err := enc.Encode(info); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url+"/_bulk", &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+s.apiKey)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("bulk request: %s: %s", resp.Status, body)
+	}
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	if json.Unmarshal(body, &result) == nil && result.Errors {
+		return fmt.Errorf("bulk request reported item errors")
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// jsonlSink appends each capture as one JSON line to a log file, rotating it
+// when it grows past maxSize or, with daily set, when the date changes.
+// Rotated files are renamed path.YYYYMMDD-HHMMSS.ffffff; only the newest
+// keep are retained when keep is positive.
+type jsonlSink struct {
+	path    string
+	maxSize int64
+	daily   bool
+	keep    int
+
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+func newJSONLSink(path string, maxSize int64, daily bool, keep int) (*jsonlSink, error) {
+	s := &jsonlSink{path: path, maxSize: maxSize, daily: daily, keep: keep}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *jsonlSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.size, s.opened = f, st.Size(), st.ModTime()
+	if s.size == 0 {
+		s.opened = time.Now()
+	}
+	return nil
+}
+
+func (s *jsonlSink) needsRotation(now time.Time) bool {
+	if s.size == 0 {
+		return false
+	}
+	if s.maxSize > 0 && s.size >= s.maxSize {
+		return true
+	}
+	return s.daily && now.Format("20060102") != s.opened.Format("20060102")
+}
+
+func (s *jsonlSink) rotate(now time.Time) error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(s.path, s.path+"."+now.Format("20060102-150405.000000")); err != nil {
+		return err
+	}
+	if s.keep > 0 {
+		old, _ := filepath.Glob(s.path + ".*")
+		sort.Strings(old)
+		for len(old) > s.keep {
+			os.Remove(old[0])
+			old = old[1:]
+		}
+	}
+	return s.open()
+}
+
+func (s *jsonlSink) WriteBatch(batch []RequestInfo) error {
+	w := bufio.NewWriter(s.f)
+	for _, info := range batch {
+		now := time.Now()
+		if s.needsRotation(now) {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if err := s.rotate(now); err != nil {
+				return err
+			}
+			w = bufio.NewWriter(s.f)
+		}
+		line, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+		s.size += int64(len(line))
+	}
+	return w.Flush()
+}
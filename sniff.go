@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/url"
+	"regexp"
+	"unicode/utf8"
+)
+
+// formBody matches a urlencoded form: name=value pairs joined by &, with no
+// whitespace anywhere
+var formBody = regexp.MustCompile(`^[^=&\s]+=[^&\s]*(?:&[^=&\s]+=[^&\s]*)*$`)
+
+// detectType classifies a body by its content alone as json, xml, form,
+// binary or text, ignoring whatever Content-Type it was sent with. Empty
+// bodies give "".
+func detectType(body []byte) string {
+	trimmed := bytes.TrimSpace(body)
+	switch {
+	case len(body) == 0:
+		return ""
+	case !utf8.Valid(body) || bytes.IndexByte(body, 0) >= 0:
+		return "binary"
+	case len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed):
+		return "json"
+	case len(trimmed) > 0 && trimmed[0] == '<' && wellFormedXML(trimmed):
+		return "xml"
+	case formBody.Match(body):
+		if _, err := url.ParseQuery(string(body)); err == nil {
+			return "form"
+		}
+	}
+	return "text"
+}
+
+// wellFormedXML reports whether body parses as an XML document with a root
+// element. HTML, with its unclosed tags and entities, generally doesn't.
+func wellFormedXML(body []byte) bool {
+	dec := newXMLDecoder(body)
+	root := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return root
+		}
+		if err != nil {
+			return false
+		}
+		if _, ok := tok.(xml.StartElement); ok {
+			root = true
+		}
+	}
+}
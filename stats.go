@@ -0,0 +1,212 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Stats summarises a set of captures for /api/v1/stats
+type Stats struct {
+	Total      int            `json:"total"`
+	ByMethod   map[string]int `json:"by_method"`
+	TopPaths   []valueCount   `json:"top_paths"`
+	TopSources []valueCount   `json:"top_sources"`
+	BodySize   sizeStats      `json:"body_size"`
+	// LastMinute counts captures in the past 60s; PerMinute averages over
+	// the span between the oldest and newest capture, at least one minute
+	LastMinute int     `json:"last_minute"`
+	PerMinute  float64 `json:"per_minute"`
+}
+
+type valueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type sizeStats struct {
+	Avg float64 `json:"avg"`
+	P50 int     `json:"p50"`
+	P90 int     `json:"p90"`
+	P99 int     `json:"p99"`
+	Max int     `json:"max"`
+}
+
+// statsHandler computes Stats over the requests matching the list filters.
+// ?top= sets how many paths and sources to return (default 10).
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	top := 10
+	if v := r.URL.Query().Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid top", http.StatusBadRequest)
+			return
+		}
+		top = n
+	}
+	list, _, ok := filteredRequests(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(computeStats(list, top, time.Now()))
+}
+
+func computeStats(list []RequestInfo, top int, now time.Time) Stats {
+	st := Stats{Total: len(list), ByMethod: map[string]int{}}
+	paths := map[string]int{}
+	sources := map[string]int{}
+	sizes := make([]int, 0, len(list))
+	total := 0
+	for _, info := range list {
+		st.ByMethod[info.Method]++
+		paths[requestPath(info)]++
+		sources[senderIP(info)]++
+		sizes = append(sizes, info.BodySize)
+		total += info.BodySize
+		if now.Sub(info.Timestamp) <= time.Minute {
+			st.LastMinute++
+		}
+	}
+	st.TopPaths = topCounts(paths, top)
+	st.TopSources = topCounts(sources, top)
+
+	if len(sizes) > 0 {
+		slices.Sort(sizes)
+		// Nearest-rank percentile
+		pct := func(p float64) int { return sizes[max(int(math.Ceil(p*float64(len(sizes))))-1, 0)] }
+		st.BodySize = sizeStats{
+			Avg: float64(total) / float64(len(sizes)),
+			P50: pct(0.50),
+			P90: pct(0.90),
+			P99: pct(0.99),
+			Max: sizes[len(sizes)-1],
+		}
+	}
+	// Lists are newest first
+	if len(list) > 0 {
+		span := max(list[0].Timestamp.Sub(list[len(list)-1].Timestamp), time.Minute)
+		st.PerMinute = float64(len(list)) / span.Minutes()
+	}
+	return st
+}
+
+// topCounts returns the n most frequent values, most frequent first
+func topCounts(counts map[string]int, n int) []valueCount {
+	out := make([]valueCount, 0, len(counts))
+	for v, c := range counts {
+		out = append(out, valueCount{Value: v, Count: c})
+	}
+	slices.SortFunc(out, func(a, b valueCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Value, b.Value)
+	})
+	return out[:min(n, len(out))]
+}
+
+// distinctFields maps each ?field= accepted by distinctHandler to the value
+// it groups by
+var distinctFields = map[string]func(RequestInfo) string{
+	"path":        requestPath,
+	"remote_addr": func(info RequestInfo) string { return senderIP(info) },
+	"method":      func(info RequestInfo) string { return info.Method },
+}
+
+// distinctHandler lists the unique values of ?field= across the requests
+// matching the list filters, most frequent first. Source addresses are
+// grouped without their port.
+func distinctHandler(w http.ResponseWriter, r *http.Request) {
+	field := r.URL.Query().Get("field")
+	value, ok := distinctFields[field]
+	if !ok {
+		http.Error(w, "Invalid field; use path, remote_addr or method", http.StatusBadRequest)
+		return
+	}
+	list, _, ok := filteredRequests(w, r)
+	if !ok {
+		return
+	}
+	counts := map[string]int{}
+	for _, info := range list {
+		counts[value(info)]++
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(topCounts(counts, len(counts)))
+}
+
+// sourceIP strips the port from a RemoteAddr
+func sourceIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// maxBuckets bounds a timeseries response
+const maxBuckets = 10000
+
+type bucketCount struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// timeseriesHandler counts matching requests per ?bucket= interval (default
+// 1m). Buckets are zero-filled across the from/to range when given, otherwise
+// across the span of the matching requests.
+func timeseriesHandler(w http.ResponseWriter, r *http.Request) {
+	bucket := time.Minute
+	if v := r.URL.Query().Get("bucket"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second {
+			http.Error(w, "Invalid bucket; use a duration of at least 1s such as 30s or 5m", http.StatusBadRequest)
+			return
+		}
+		bucket = d
+	}
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, _, ok := filteredRequests(w, r)
+	if !ok {
+		return
+	}
+
+	from, to := filter.From, filter.To
+	if len(list) > 0 {
+		if from.IsZero() {
+			from = list[len(list)-1].Timestamp
+		}
+		if to.IsZero() {
+			to = list[0].Timestamp.Add(time.Nanosecond)
+		}
+	}
+	series := []bucketCount{}
+	if !from.IsZero() && to.After(from) {
+		from = from.Truncate(bucket)
+		n := int((to.Sub(from)-1)/bucket) + 1
+		if n > maxBuckets {
+			http.Error(w, "Too many buckets; use a larger bucket or narrower range", http.StatusBadRequest)
+			return
+		}
+		series = make([]bucketCount, n)
+		for i := range series {
+			series[i].Start = from.Add(time.Duration(i) * bucket)
+		}
+		for _, info := range list {
+			if i := int(info.Timestamp.Sub(from) / bucket); i >= 0 && i < n {
+				series[i].Count++
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNotFound is returned by Store lookups for an unknown request ID
+var ErrNotFound = errors.New("request not found")
+
+// errStopEach ends a Store.Each iteration early; callers discard it
+var errStopEach = errors.New("stop iteration")
+
+// Store persists captured requests. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Add saves a request and assigns it the next ID
+	Add(info *RequestInfo) error
+	// List returns all stored requests, newest first
+	List() ([]RequestInfo, error)
+	// Each streams stored requests to fn, newest first, stopping at the
+	// first error fn returns. fn must not call back into the store.
+	Each(fn func(RequestInfo) error) error
+	// Get returns a single request, or ErrNotFound
+	Get(id int) (RequestInfo, error)
+	// Update applies fn to a stored request in place, or returns ErrNotFound.
+	// fn sees the stored form, in which headers and body may be encoded by
+	// decorators, so it must only change annotation fields such as Notes.
+	Update(id int, fn func(*RequestInfo)) error
+	// Delete removes a single request, or returns ErrNotFound
+	Delete(id int) error
+	// Clear removes every stored request
+	Clear() error
+	// Count returns the number of stored requests
+	Count() (int, error)
+	// Size returns the approximate bytes the stored requests occupy
+	Size() (int64, error)
+	Close() error
+}
+
+// approxSize estimates the bytes info occupies, counting its strings plus a
+// fixed per-request overhead for the struct and map bookkeeping
+func approxSize(info RequestInfo) int64 {
+	n := 256 + len(info.Method) + len(info.URL) + len(info.Body) + len(info.RemoteAddr) +
+		len(info.BodyHash) + len(info.BodyRef) + len(info.Sealed) + len(info.Raw) + len(info.DecodedBody)
+	for _, m := range []map[string][]string{info.Headers, info.Trailers, info.Query, info.Form} {
+		for k, values := range m {
+			n += len(k) + 32
+			for _, v := range values {
+				n += len(v) + 16
+			}
+		}
+	}
+	for _, c := range info.Cookies {
+		n += len(c.Name) + len(c.Value) + 32
+	}
+	for _, f := range info.Files {
+		n += len(f.Field) + len(f.Filename) + len(f.ContentType) + 48
+	}
+	if info.XML != nil {
+		n += len(info.XML.Pretty) + len(info.XML.Root) + len(info.XML.Namespace) + len(info.XML.SOAPAction) + 64
+	}
+	if info.GraphQL != nil {
+		n += len(info.GraphQL.Query) + len(info.GraphQL.Variables) + len(info.GraphQL.OperationName)
+	}
+	if info.JWT != nil {
+		// Decoded claims take about as much as the token they came from
+		n += len(info.Headers.Get("Authorization"))
+	}
+	return int64(n)
+}
+
+func openStore(cfg Config) (Store, error) {
+	s, err := openBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := loadEncryptionKey(cfg.EncryptionKeyFile)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	if aead != nil {
+		s = &encryptStore{Store: s, aead: aead}
+	}
+	// Always wrapped so bodies compressed under an earlier --compress
+	// setting stay readable
+	cs, err := newCompressStore(s, cfg.Compress)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s = cs
+	if cfg.SpillThreshold > 0 {
+		sp, err := newSpillStore(s, cfg.SpillDir, int(cfg.SpillThreshold), aead, cs)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s = sp
+	}
+	return newTallyStore(&eventStore{Store: s}), nil
+}
+
+func openBackend(cfg Config) (Store, error) {
+	if cfg.WALPath != "" && cfg.Store != "memory" {
+		return nil, fmt.Errorf("--wal is only supported by the memory store")
+	}
+	switch cfg.Store {
+	case "memory":
+		if cfg.WALPath != "" {
+			return newWALStore(cfg.WALPath)
+		}
+		return newMemoryStore(), nil
+	case "sqlite":
+		return newSQLiteStore(cfg.DBPath)
+	case "bolt":
+		return newBoltStore(cfg.DBPath)
+	case "postgres":
+		return newPostgresStore(cfg.DBURL, cfg.DBMaxConns)
+	case "redis":
+		return newRedisStore(cfg.RedisURL, cfg.RedisPrefix)
+	}
+	return nil, fmt.Errorf("unknown store %q", cfg.Store)
+}
+
+// memoryStore keeps requests in a slice, newest first. Identical bodies, such
+// as a provider retrying the same payload, share a single copy.
+type memoryStore struct {
+	mu       sync.RWMutex
+	requests []RequestInfo
+	nextID   int
+	bodies   map[string]*sharedBody
+	size     int64
+}
+
+// sharedBody is a reference-counted body shared by identical captures
+type sharedBody struct {
+	body string
+	refs int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{nextID: 1, bodies: make(map[string]*sharedBody)}
+}
+
+// bodyKey identifies a stored body. The hash covers the original body, so
+// the stored encoding is part of the key.
+func bodyKey(info RequestInfo) string {
+	return fmt.Sprintf("%s/%s/%t", info.BodyHash, info.BodyCompression, info.BodyRef != "")
+}
+
+// intern points info at the shared copy of its body; callers hold s.mu
+func (s *memoryStore) intern(info *RequestInfo) {
+	s.size += approxSize(*info) - int64(len(info.Body))
+	if info.BodyHash == "" {
+		s.size += int64(len(info.Body))
+		return
+	}
+	key := bodyKey(*info)
+	if sb, ok := s.bodies[key]; ok {
+		sb.refs++
+		info.Body = sb.body
+		return
+	}
+	s.bodies[key] = &sharedBody{body: info.Body, refs: 1}
+	s.size += int64(len(info.Body))
+}
+
+// release drops info's reference to its shared body; callers hold s.mu
+func (s *memoryStore) release(info RequestInfo) {
+	s.size -= approxSize(info) - int64(len(info.Body))
+	if info.BodyHash == "" {
+		s.size -= int64(len(info.Body))
+		return
+	}
+	key := bodyKey(info)
+	if sb, ok := s.bodies[key]; ok {
+		if sb.refs--; sb.refs <= 0 {
+			delete(s.bodies, key)
+			s.size -= int64(len(sb.body))
+		}
+	}
+}
+
+func (s *memoryStore) Add(info *RequestInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info.ID = s.nextID
+	s.nextID++
+	stored := *info
+	s.intern(&stored)
+	// Prepend to show newest first
+	s.requests = append([]RequestInfo{stored}, s.requests...)
+	return nil
+}
+
+func (s *memoryStore) List() ([]RequestInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]RequestInfo, len(s.requests))
+	copy(out, s.requests)
+	return out, nil
+}
+
+func (s *memoryStore) Each(fn func(RequestInfo) error) error {
+	// Iterate a snapshot so fn runs without holding the lock
+	list, _ := s.List()
+	for _, info := range list {
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restore inserts a previously stored request, keeping its ID
+func (s *memoryStore) restore(info RequestInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.intern(&info)
+	s.requests = append([]RequestInfo{info}, s.requests...)
+	if info.ID >= s.nextID {
+		s.nextID = info.ID + 1
+	}
+}
+
+func (s *memoryStore) Get(id int) (RequestInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, info := range s.requests {
+		if info.ID == id {
+			return info, nil
+		}
+	}
+	return RequestInfo{}, ErrNotFound
+}
+
+func (s *memoryStore) Update(id int, fn func(*RequestInfo)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.requests {
+		if s.requests[i].ID == id {
+			fn(&s.requests[i])
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memoryStore) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, info := range s.requests {
+		if info.ID == id {
+			s.release(info)
+			s.requests = append(s.requests[:i:i], s.requests[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memoryStore) Count() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.requests), nil
+}
+
+func (s *memoryStore) Size() (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.size, nil
+}
+
+func (s *memoryStore) Clear() error {
+	s.mu.Lock()
+	s.requests = nil
+	s.bodies = make(map[string]*sharedBody)
+	s.size = 0
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Close() error { return nil }
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	requestsBucket = []byte("requests")
+	byTimeBucket   = []byte("requests_by_time")
+)
+
+// boltStore keeps requests in an embedded bbolt file. Requests are keyed by
+// big-endian ID, and listed newest first by a reverse walk of a secondary
+// index on arrival time, since imported and restored captures keep their
+// original timestamps under new IDs. Retention's newest-first pass, which the
+// count caps and --max-age go by, follows that order too.
+type boltStore struct {
+	db *bolt.DB
+}
+
+func newBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(requestsBucket); err != nil {
+			return err
+		}
+		idx, err := tx.CreateBucketIfNotExists(byTimeBucket)
+		if err != nil {
+			return err
+		}
+		if idx.Stats().KeyN != tx.Bucket(requestsBucket).Stats().KeyN {
+			// Files written without the index, or with it out of step
+			return reindexTimes(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func idKey(id int) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(id))
+	return k
+}
+
+// timeKey orders requests by timestamp, then ID; times before 1970, such as
+// an imported capture's missing one, sort first
+func timeKey(t time.Time, id int) []byte {
+	var ns int64
+	if t.After(time.Unix(0, 0)) {
+		ns = t.UnixNano()
+	}
+	k := make([]byte, 16)
+	binary.BigEndian.PutUint64(k, uint64(ns))
+	binary.BigEndian.PutUint64(k[8:], uint64(id))
+	return k
+}
+
+// reindexTimes rebuilds the timestamp index from the requests
+func reindexTimes(tx *bolt.Tx) error {
+	if err := tx.DeleteBucket(byTimeBucket); err != nil {
+		return err
+	}
+	idx, err := tx.CreateBucket(byTimeBucket)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(requestsBucket).ForEach(func(k, v []byte) error {
+		var info RequestInfo
+		if err := json.Unmarshal(v, &info); err != nil {
+			return err
+		}
+		return idx.Put(timeKey(info.Timestamp, info.ID), k)
+	})
+}
+
+func (s *boltStore) Add(info *RequestInfo) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(requestsBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		info.ID = int(seq)
+		data, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(idKey(info.ID), data); err != nil {
+			return err
+		}
+		return tx.Bucket(byTimeBucket).Put(timeKey(info.Timestamp, info.ID), idKey(info.ID))
+	})
+}
+
+func (s *boltStore) List() ([]RequestInfo, error) {
+	out := []RequestInfo{}
+	err := s.Each(func(info RequestInfo) error {
+		out = append(out, info)
+		return nil
+	})
+	return out, err
+}
+
+func (s *boltStore) Each(fn func(RequestInfo) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(requestsBucket)
+		c := tx.Bucket(byTimeBucket).Cursor()
+		for _, id := c.Last(); id != nil; _, id = c.Prev() {
+			v := b.Get(id)
+			if v == nil {
+				continue
+			}
+			var info RequestInfo
+			if err := json.Unmarshal(v, &info); err != nil {
+				return err
+			}
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Get(id int) (RequestInfo, error) {
+	var info RequestInfo
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(requestsBucket).Get(idKey(id))
+		if v == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(v, &info)
+	})
+	return info, err
+}
+
+func (s *boltStore) Update(id int, fn func(*RequestInfo)) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(requestsBucket)
+		v := b.Get(idKey(id))
+		if v == nil {
+			return ErrNotFound
+		}
+		var info RequestInfo
+		if err := json.Unmarshal(v, &info); err != nil {
+			return err
+		}
+		before := info.Timestamp
+		fn(&info)
+		data, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		if !info.Timestamp.Equal(before) {
+			idx := tx.Bucket(byTimeBucket)
+			if err := idx.Delete(timeKey(before, id)); err != nil {
+				return err
+			}
+			if err := idx.Put(timeKey(info.Timestamp, id), idKey(id)); err != nil {
+				return err
+			}
+		}
+		return b.Put(idKey(id), data)
+	})
+}
+
+func (s *boltStore) Delete(id int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(requestsBucket)
+		v := b.Get(idKey(id))
+		if v == nil {
+			return ErrNotFound
+		}
+		var info RequestInfo
+		if err := json.Unmarshal(v, &info); err != nil {
+			return err
+		}
+		if err := tx.Bucket(byTimeBucket).Delete(timeKey(info.Timestamp, id)); err != nil {
+			return err
+		}
+		return b.Delete(idKey(id))
+	})
+}
+
+func (s *boltStore) Count() (int, error) {
+	var n int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(requestsBucket).Stats().KeyN
+		return nil
+	})
+	return n, err
+}
+
+func (s *boltStore) Size() (int64, error) {
+	var n int64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(requestsBucket).ForEach(func(k, v []byte) error {
+			n += int64(len(k) + len(v))
+			return nil
+		})
+	})
+	return n, err
+}
+
+func (s *boltStore) Clear() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{requestsBucket, byTimeBucket} {
+			b := tx.Bucket(name)
+			// Preserve the ID sequence so IDs are never reused after a clear
+			seq := b.Sequence()
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			nb, err := tx.CreateBucket(name)
+			if err != nil {
+				return err
+			}
+			if err := nb.SetSequence(seq); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltURLs lists s's captures by URL, in the order the store gives them
+func boltURLs(t *testing.T, s Store) []string {
+	t.Helper()
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for _, info := range list {
+		urls = append(urls, info.URL)
+	}
+	return urls
+}
+
+func TestBoltListsByTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requests.db")
+	s, err := newBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	s.Add(&RequestInfo{URL: "/live", Timestamp: now})
+	// Imported later, so with higher IDs, but captured earlier
+	s.Add(&RequestInfo{URL: "/imported-new", Timestamp: now.Add(-time.Hour)})
+	s.Add(&RequestInfo{URL: "/imported-old", Timestamp: now.Add(-72 * time.Hour)})
+	s.Add(&RequestInfo{URL: "/undated"})
+	want := []string{"/live", "/imported-new", "/imported-old", "/undated"}
+	if got := boltURLs(t, s); !slices.Equal(got, want) {
+		t.Errorf("listed %v, want %v", got, want)
+	}
+
+	s.Update(4, func(info *RequestInfo) { info.Timestamp = now.Add(time.Minute) })
+	want = []string{"/undated", "/live", "/imported-new", "/imported-old"}
+	if got := boltURLs(t, s); !slices.Equal(got, want) {
+		t.Errorf("after moving a timestamp listed %v, want %v", got, want)
+	}
+
+	// Count caps keep the newest by time, and --max-age goes by timestamps
+	bins = &binRegistry{bins: map[string]Bin{}}
+	if n, err := (Retention{MaxRequests: 3, MaxAge: 24 * time.Hour}).prune(s); err != nil || n != 1 {
+		t.Fatalf("prune removed %d, %v; want 1", n, err)
+	}
+	want = []string{"/undated", "/live", "/imported-new"}
+	if got := boltURLs(t, s); !slices.Equal(got, want) {
+		t.Errorf("after prune listed %v, want %v", got, want)
+	}
+	if n, _ := s.Count(); n != 3 {
+		t.Errorf("Count = %d after prune, want 3", n)
+	}
+
+	// A file whose index is missing gets it rebuilt when opened
+	err = s.db.Update(func(tx *bolt.Tx) error { return tx.DeleteBucket(byTimeBucket) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	s, err = newBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := boltURLs(t, s); !slices.Equal(got, want) {
+		t.Errorf("after reindexing listed %v, want %v", got, want)
+	}
+	s.Clear()
+	s.Add(&RequestInfo{URL: "/after-clear", Timestamp: now})
+	if got := boltURLs(t, s); !slices.Equal(got, []string{"/after-clear"}) {
+		t.Errorf("after clear listed %v", got)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressMinSize skips bodies too small for compression to pay off
+const compressMinSize = 128
+
+// compressStore wraps a Store and keeps bodies compressed at rest. Compressed
+// bodies are stored base64-encoded with BodyCompression naming the codec, and
+// are expanded again on every read so callers never see the stored form.
+type compressStore struct {
+	Store
+	codec string
+	zenc  *zstd.Encoder
+	zdec  *zstd.Decoder
+}
+
+// newCompressStore wraps inner with the given codec. With codec "none" new
+// bodies are stored as-is but previously compressed ones still read back.
+func newCompressStore(inner Store, codec string) (*compressStore, error) {
+	switch codec {
+	case "none", "gzip", "zstd":
+	default:
+		return nil, fmt.Errorf("unknown compression %q", codec)
+	}
+	s := &compressStore{Store: inner, codec: codec}
+	var err error
+	if s.zenc, err = zstd.NewWriter(nil); err != nil {
+		return nil, err
+	}
+	if s.zdec, err = zstd.NewReader(nil); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *compressStore) compress(body string) ([]byte, error) {
+	if s.codec == "zstd" {
+		return s.zenc.EncodeAll([]byte(body), nil), nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(zw, body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// expand restores a body compressed with either codec, so changing --compress
+// keeps older captures readable
+func (s *compressStore) expand(info *RequestInfo) error {
+	if info.BodyCompression == "" {
+		return nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(info.Body)
+	if err != nil {
+		return err
+	}
+	body, err := s.decode(info.BodyCompression, raw)
+	if err != nil {
+		return fmt.Errorf("request %d: %w", info.ID, err)
+	}
+	info.Body = string(body)
+	info.BodyCompression = ""
+	return nil
+}
+
+// decode expands raw, compressed with codec
+func (s *compressStore) decode(codec string, raw []byte) ([]byte, error) {
+	switch codec {
+	case "zstd":
+		return s.zdec.DecodeAll(raw, nil)
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(zr)
+	}
+	return nil, fmt.Errorf("unknown compression %q", codec)
+}
+
+func (s *compressStore) Add(info *RequestInfo) error {
+	if s.codec == "none" || len(info.Body) < compressMinSize {
+		return s.Store.Add(info)
+	}
+	packed, err := s.compress(info.Body)
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(packed)
+	if len(encoded) >= len(info.Body) {
+		return s.Store.Add(info)
+	}
+	stored := *info
+	stored.Body = encoded
+	stored.BodyCompression = s.codec
+	if err := s.Store.Add(&stored); err != nil {
+		return err
+	}
+	info.ID = stored.ID
+	return nil
+}
+
+func (s *compressStore) List() ([]RequestInfo, error) {
+	list, err := s.Store.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if err := s.expand(&list[i]); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+func (s *compressStore) Each(fn func(RequestInfo) error) error {
+	return s.Store.Each(func(info RequestInfo) error {
+		if err := s.expand(&info); err != nil {
+			return err
+		}
+		return fn(info)
+	})
+}
+
+func (s *compressStore) Get(id int) (RequestInfo, error) {
+	info, err := s.Store.Get(id)
+	if err != nil {
+		return info, err
+	}
+	return info, s.expand(&info)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// sealedFields is the plaintext sealed into RequestInfo.Sealed
+type sealedFields struct {
+	URL        string          `json:"url"`
+	Query      url.Values      `json:"query,omitempty"`
+	Headers    Header          `json:"headers"`
+	Cookies    []Cookie        `json:"cookies,omitempty"`
+	UserAgent  *UserAgent      `json:"user_agent,omitempty"`
+	JWT        *JWT            `json:"jwt,omitempty"`
+	Trailers   Header          `json:"trailers,omitempty"`
+	Body       string          `json:"body"`
+	GraphQL    *GraphQL        `json:"graphql,omitempty"`
+	Decoded    json.RawMessage `json:"decoded_body,omitempty"`
+	XML        string          `json:"xml_pretty,omitempty"`
+	Form       url.Values      `json:"form,omitempty"`
+	Files      []FilePart      `json:"files,omitempty"`
+	Raw        []byte          `json:"raw,omitempty"`
+	Reply      *Reply          `json:"reply,omitempty"`
+	RuleGroups ruleGroups      `json:"rule_groups,omitempty"`
+}
+
+// encryptStore wraps a Store and seals each request's URL and query,
+// headers with the cookies, user agent and bearer token parsed from them,
+// trailers, body (with its GraphQL, decoded and pretty XML forms), form and
+// uploads, raw dump, the reply it was answered with and what a rule's
+// patterns caught, with AES-GCM before they reach the backend, so a copied
+// database file does not leak tokens or PII. Left readable, for ordering,
+// retention, quotas and the TUI, are the bin, method, protocol, TLS details,
+// body size, hash, sniffed type and encodings, the XML root and SOAP action,
+// CloudEvents attributes, timing, timestamps, addresses, geo and reverse DNS
+// name, connection details, status, rule ID, notes, tags and pin.
+type encryptStore struct {
+	Store
+	aead cipher.AEAD
+}
+
+// loadEncryptionKey reads a base64-encoded 16, 24 or 32 byte AES key from the
+// ENCRYPTION_KEY environment variable or from path (e.g. a file written by a
+// KMS or secrets-manager agent). It returns nil when neither is configured.
+func loadEncryptionKey(path string) (cipher.AEAD, error) {
+	encoded := os.Getenv("ENCRYPTION_KEY")
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(data)
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not valid base64: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func xmlPretty(x *XMLInfo) string {
+	if x == nil {
+		return ""
+	}
+	return x.Pretty
+}
+
+// seal encrypts plaintext, prefixing the random nonce
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func unseal(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("sealed data too short")
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, data[:n], data[n:], nil)
+}
+
+func (s *encryptStore) Add(info *RequestInfo) error {
+	plain, err := json.Marshal(sealedFields{
+		URL: info.URL, Query: info.Query,
+		Headers: info.Headers, Cookies: info.Cookies, UserAgent: info.UserAgent, JWT: info.JWT, Trailers: info.Trailers,
+		Body: info.Body, GraphQL: info.GraphQL, Decoded: info.DecodedBody, XML: xmlPretty(info.XML), Form: info.Form, Files: info.Files, Raw: info.Raw,
+		Reply: info.Reply, RuleGroups: info.RuleGroups,
+	})
+	if err != nil {
+		return err
+	}
+	sealed, err := seal(s.aead, plain)
+	if err != nil {
+		return err
+	}
+	stored := *info
+	stored.URL, stored.Query, stored.UserAgent = "", nil, nil
+	stored.Headers, stored.Cookies, stored.JWT, stored.Trailers = nil, nil, nil, nil
+	stored.Body, stored.GraphQL, stored.DecodedBody = "", nil, nil
+	if info.XML != nil {
+		// The root element and SOAP action stay readable, like the method
+		x := *info.XML
+		x.Pretty = ""
+		stored.XML = &x
+	}
+	stored.Form, stored.Files, stored.Raw = nil, nil, nil
+	stored.Reply, stored.RuleGroups = nil, nil
+	stored.Sealed = base64.StdEncoding.EncodeToString(sealed)
+	if err := s.Store.Add(&stored); err != nil {
+		return err
+	}
+	info.ID = stored.ID
+	return nil
+}
+
+func (s *encryptStore) open(info *RequestInfo) error {
+	if info.Sealed == "" {
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(info.Sealed)
+	if err != nil {
+		return err
+	}
+	plain, err := unseal(s.aead, data)
+	if err != nil {
+		return fmt.Errorf("request %d: %w", info.ID, err)
+	}
+	var f sealedFields
+	if err := json.Unmarshal(plain, &f); err != nil {
+		return err
+	}
+	if f.URL != "" {
+		// Captures sealed before the URL was kept their URL, query, user
+		// agent, reply and groups in the clear
+		info.URL, info.Query, info.UserAgent = f.URL, f.Query, f.UserAgent
+		info.Reply, info.RuleGroups = f.Reply, f.RuleGroups
+	}
+	info.Headers, info.Cookies, info.JWT, info.Trailers = f.Headers, f.Cookies, f.JWT, f.Trailers
+	info.Body, info.GraphQL, info.DecodedBody, info.Sealed = f.Body, f.GraphQL, f.Decoded, ""
+	if info.XML != nil {
+		x := *info.XML
+		x.Pretty = f.XML
+		info.XML = &x
+	}
+	info.Form, info.Files, info.Raw = f.Form, f.Files, f.Raw
+	return nil
+}
+
+func (s *encryptStore) List() ([]RequestInfo, error) {
+	list, err := s.Store.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if err := s.open(&list[i]); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+func (s *encryptStore) Each(fn func(RequestInfo) error) error {
+	return s.Store.Each(func(info RequestInfo) error {
+		if err := s.open(&info); err != nil {
+			return err
+		}
+		return fn(info)
+	})
+}
+
+func (s *encryptStore) Get(id int) (RequestInfo, error) {
+	info, err := s.Store.Get(id)
+	if err != nil {
+		return info, err
+	}
+	return info, s.open(&info)
+}
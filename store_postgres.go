@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresMigrations are applied in order and recorded in schema_migrations.
+// Append new statements; never edit ones that have shipped.
+var postgresMigrations = []string{
+	`CREATE TABLE requests (
+		id        BIGSERIAL PRIMARY KEY,
+		timestamp TIMESTAMPTZ NOT NULL,
+		data      JSONB NOT NULL
+	)`,
+	`CREATE INDEX requests_timestamp_idx ON requests (timestamp)`,
+}
+
+// postgresStore keeps requests in PostgreSQL so several replicas can share
+// one capture history
+type postgresStore struct {
+	pool *pgxpool.Pool
+}
+
+func newPostgresStore(url string, maxConns int) (*postgresStore, error) {
+	pcfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return nil, err
+	}
+	if maxConns > 0 {
+		pcfg.MaxConns = int32(maxConns)
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.NewWithConfig(ctx, pcfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := migratePostgres(ctx, pool); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	return &postgresStore{pool: pool}, nil
+}
+
+// migratePostgres applies pending migrations. An advisory lock keeps replicas
+// that start at the same time from racing each other.
+func migratePostgres(ctx context.Context, pool *pgxpool.Pool) error {
+	return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(7312201)`); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INT PRIMARY KEY)`); err != nil {
+			return err
+		}
+		var current int
+		if err := tx.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+			return err
+		}
+		for i := current; i < len(postgresMigrations); i++ {
+			if _, err := tx.Exec(ctx, postgresMigrations[i]); err != nil {
+				return fmt.Errorf("migration %d: %w", i+1, err)
+			}
+			if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, i+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *postgresStore) Add(info *RequestInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return s.pool.QueryRow(context.Background(),
+		`INSERT INTO requests (timestamp, data) VALUES ($1, $2) RETURNING id`,
+		info.Timestamp, data).Scan(&info.ID)
+}
+
+func (s *postgresStore) List() ([]RequestInfo, error) {
+	out := []RequestInfo{}
+	err := s.Each(func(info RequestInfo) error {
+		out = append(out, info)
+		return nil
+	})
+	return out, err
+}
+
+func (s *postgresStore) Each(fn func(RequestInfo) error) error {
+	rows, err := s.pool.Query(context.Background(), `SELECT id, data FROM requests ORDER BY id DESC`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var data []byte
+		if err := rows.Scan(&id, &data); err != nil {
+			return err
+		}
+		var info RequestInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			return err
+		}
+		info.ID = id
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *postgresStore) Get(id int) (RequestInfo, error) {
+	var data []byte
+	err := s.pool.QueryRow(context.Background(), `SELECT data FROM requests WHERE id = $1`, id).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return RequestInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return RequestInfo{}, err
+	}
+	var info RequestInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return RequestInfo{}, err
+	}
+	info.ID = id
+	return info, nil
+}
+
+func (s *postgresStore) Update(id int, fn func(*RequestInfo)) error {
+	ctx := context.Background()
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		var data []byte
+		err := tx.QueryRow(ctx, `SELECT data FROM requests WHERE id = $1 FOR UPDATE`, id).Scan(&data)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var info RequestInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			return err
+		}
+		info.ID = id
+		fn(&info)
+		updated, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE requests SET data = $1 WHERE id = $2`, updated, id)
+		return err
+	})
+}
+
+func (s *postgresStore) Delete(id int) error {
+	tag, err := s.pool.Exec(context.Background(), `DELETE FROM requests WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *postgresStore) Count() (int, error) {
+	var n int
+	err := s.pool.QueryRow(context.Background(), `SELECT COUNT(*) FROM requests`).Scan(&n)
+	return n, err
+}
+
+func (s *postgresStore) Size() (int64, error) {
+	var n int64
+	err := s.pool.QueryRow(context.Background(), `SELECT COALESCE(SUM(pg_column_size(data)), 0) FROM requests`).Scan(&n)
+	return n, err
+}
+
+func (s *postgresStore) Clear() error {
+	_, err := s.pool.Exec(context.Background(), `DELETE FROM requests`)
+	return err
+}
+
+func (s *postgresStore) Close() error {
+	s.pool.Close()
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisStore keeps requests in Redis so several instances behind a load
+// balancer share one history. Requests live in a hash keyed by ID, with a
+// sorted set of IDs providing newest-first ordering.
+type redisStore struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+func newRedisStore(url, prefix string) (*redisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	rdb := redis.NewClient(opts)
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		rdb.Close()
+		return nil, err
+	}
+	return &redisStore{rdb: rdb, prefix: prefix}, nil
+}
+
+func (s *redisStore) key(name string) string { return s.prefix + name }
+
+func (s *redisStore) Add(info *RequestInfo) error {
+	ctx := context.Background()
+	id, err := s.rdb.Incr(ctx, s.key("next_id")).Result()
+	if err != nil {
+		return err
+	}
+	info.ID = int(id)
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	member := strconv.FormatInt(id, 10)
+	_, err = s.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HSet(ctx, s.key("requests"), member, data)
+		p.ZAdd(ctx, s.key("index"), redis.Z{Score: float64(id), Member: member})
+		return nil
+	})
+	return err
+}
+
+func (s *redisStore) List() ([]RequestInfo, error) {
+	out := []RequestInfo{}
+	err := s.Each(func(info RequestInfo) error {
+		out = append(out, info)
+		return nil
+	})
+	return out, err
+}
+
+// redisPageSize is how many requests Each fetches per round trip
+const redisPageSize = 200
+
+func (s *redisStore) Each(fn func(RequestInfo) error) error {
+	ctx := context.Background()
+	// Page by score so concurrent inserts and deletes don't shift the window
+	maxScore := "+inf"
+	for {
+		ids, err := s.rdb.ZRevRangeByScore(ctx, s.key("index"), &redis.ZRangeBy{
+			Max: maxScore, Min: "-inf", Count: redisPageSize,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		vals, err := s.rdb.HMGet(ctx, s.key("requests"), ids...).Result()
+		if err != nil {
+			return err
+		}
+		for _, v := range vals {
+			data, ok := v.(string)
+			if !ok {
+				// Deleted by another instance between the two reads
+				continue
+			}
+			var info RequestInfo
+			if err := json.Unmarshal([]byte(data), &info); err != nil {
+				return err
+			}
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+		maxScore = "(" + ids[len(ids)-1]
+	}
+}
+
+func (s *redisStore) Get(id int) (RequestInfo, error) {
+	data, err := s.rdb.HGet(context.Background(), s.key("requests"), strconv.Itoa(id)).Bytes()
+	if err == redis.Nil {
+		return RequestInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return RequestInfo{}, err
+	}
+	var info RequestInfo
+	err = json.Unmarshal(data, &info)
+	return info, err
+}
+
+func (s *redisStore) Update(id int, fn func(*RequestInfo)) error {
+	ctx := context.Background()
+	key, member := s.key("requests"), strconv.Itoa(id)
+	// Optimistic lock: retry if another instance changes the hash meanwhile
+	for {
+		err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+			data, err := tx.HGet(ctx, key, member).Bytes()
+			if err == redis.Nil {
+				return ErrNotFound
+			}
+			if err != nil {
+				return err
+			}
+			var info RequestInfo
+			if err := json.Unmarshal(data, &info); err != nil {
+				return err
+			}
+			fn(&info)
+			updated, err := json.Marshal(info)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+				p.HSet(ctx, key, member, updated)
+				return nil
+			})
+			return err
+		}, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+}
+
+func (s *redisStore) Delete(id int) error {
+	ctx := context.Background()
+	member := strconv.Itoa(id)
+	var del *redis.IntCmd
+	_, err := s.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		del = p.HDel(ctx, s.key("requests"), member)
+		p.ZRem(ctx, s.key("index"), member)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if del.Val() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *redisStore) Clear() error {
+	// next_id is kept so IDs are never reused after a clear
+	return s.rdb.Del(context.Background(), s.key("requests"), s.key("index")).Err()
+}
+
+func (s *redisStore) Count() (int, error) {
+	n, err := s.rdb.ZCard(context.Background(), s.key("index")).Result()
+	return int(n), err
+}
+
+func (s *redisStore) Size() (int64, error) {
+	ctx := context.Background()
+	var n int64
+	iter := s.rdb.HScan(ctx, s.key("requests"), 0, "", 500).Iterator()
+	for iter.Next(ctx) {
+		n += int64(len(iter.Val()))
+	}
+	return n, iter.Err()
+}
+
+func (s *redisStore) Close() error {
+	return s.rdb.Close()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// spillPreviewSize is how much of a spilled body stays inline as a preview
+const spillPreviewSize = 1024
+
+// spillStore wraps a Store and moves bodies larger than threshold into files
+// under dir. The wrapped store only holds a preview and a reference; Get
+// and Each hydrate the full body, List returns previews. Spill files are
+// compressed with the --compress codec, named by their extension, and with
+// aead set encrypted like the rest of the store.
+type spillStore struct {
+	Store
+	dir       string
+	threshold int
+	aead      cipher.AEAD
+	codec     *compressStore
+}
+
+func newSpillStore(inner Store, dir string, threshold int, aead cipher.AEAD, codec *compressStore) (*spillStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &spillStore{Store: inner, dir: dir, threshold: threshold, aead: aead, codec: codec}, nil
+}
+
+func (s *spillStore) Add(info *RequestInfo) error {
+	if len(info.Body) <= s.threshold {
+		return s.Store.Add(info)
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	ref := hex.EncodeToString(b)
+	data := []byte(info.Body)
+	if s.codec != nil && s.codec.codec != "none" {
+		packed, err := s.codec.compress(info.Body)
+		if err != nil {
+			return err
+		}
+		if len(packed) < len(data) {
+			data, ref = packed, ref+"."+s.codec.codec
+		}
+	}
+	if s.aead != nil {
+		var err error
+		if data, err = seal(s.aead, data); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, ref), data, 0o600); err != nil {
+		return err
+	}
+
+	stored := *info
+	stored.Body = strings.ToValidUTF8(info.Body[:min(spillPreviewSize, s.threshold)], "")
+	stored.BodyRef = ref
+	if err := s.Store.Add(&stored); err != nil {
+		os.Remove(filepath.Join(s.dir, ref))
+		return err
+	}
+	info.ID = stored.ID
+	info.BodyRef = ref
+	return nil
+}
+
+func (s *spillStore) Get(id int) (RequestInfo, error) {
+	info, err := s.Store.Get(id)
+	if err != nil {
+		return info, err
+	}
+	return info, s.hydrate(&info)
+}
+
+// Each streams requests with their full bodies, read straight from the spill
+// files so fn never waits on the wrapped store
+func (s *spillStore) Each(fn func(RequestInfo) error) error {
+	return s.Store.Each(func(info RequestInfo) error {
+		if err := s.hydrate(&info); err != nil {
+			return err
+		}
+		return fn(info)
+	})
+}
+
+// hydrate replaces a spilled preview with the full body from its file
+func (s *spillStore) hydrate(info *RequestInfo) error {
+	if info.BodyRef == "" {
+		return nil
+	}
+	body, err := os.ReadFile(filepath.Join(s.dir, info.BodyRef))
+	if err == nil && s.aead != nil {
+		body, err = unseal(s.aead, body)
+	}
+	if codec := strings.TrimPrefix(filepath.Ext(info.BodyRef), "."); err == nil && codec != "" {
+		body, err = s.codec.decode(codec, body)
+	}
+	if err != nil {
+		return err
+	}
+	info.Body = string(body)
+	return nil
+}
+
+func (s *spillStore) Delete(id int) error {
+	info, err := s.Store.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.Delete(id); err != nil {
+		return err
+	}
+	if info.BodyRef != "" {
+		os.Remove(filepath.Join(s.dir, info.BodyRef))
+	}
+	return nil
+}
+
+func (s *spillStore) Clear() error {
+	if err := s.Store.Clear(); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		os.Remove(filepath.Join(s.dir, e.Name()))
+	}
+	return nil
+}
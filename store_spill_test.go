@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSpillFilesCompressed(t *testing.T) {
+	for _, codec := range []string{"none", "gzip", "zstd"} {
+		dir := t.TempDir()
+		cs, err := newCompressStore(newMemoryStore(), codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := newSpillStore(cs, dir, 4096, nil, cs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := strings.Repeat(`{"event":"order.created","id":42}`, 1000)
+		info := RequestInfo{Body: body}
+		if err := s.Add(&info); err != nil {
+			t.Fatal(err)
+		}
+		st, err := os.Stat(filepath.Join(dir, info.BodyRef))
+		if err != nil {
+			t.Fatalf("%s: spill file: %v", codec, err)
+		}
+		if compressed := st.Size() < int64(len(body)); compressed != (codec != "none") {
+			t.Errorf("%s: spill file holds %d bytes of a %d byte body", codec, st.Size(), len(body))
+		}
+		got, err := s.Get(info.ID)
+		if err != nil || got.Body != body {
+			t.Errorf("%s: Get = %d bytes, %v; want the whole body", codec, len(got.Body), err)
+		}
+		list, _ := s.List()
+		if len(list) != 1 || len(list[0].Body) > spillPreviewSize {
+			t.Errorf("%s: List gave %d bytes, want a preview", codec, len(list[0].Body))
+		}
+	}
+}
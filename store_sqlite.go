@@ -0,0 +1,164 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteStore keeps requests in a SQLite database so they survive restarts
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func newSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; serialising access avoids SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS requests (
+		id        INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp DATETIME NOT NULL,
+		data      TEXT NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create schema: %w", err)
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) Add(info *RequestInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec(`INSERT INTO requests (timestamp, data) VALUES (?, ?)`, info.Timestamp, string(data))
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	info.ID = int(id)
+	return nil
+}
+
+func (s *sqliteStore) List() ([]RequestInfo, error) {
+	out := []RequestInfo{}
+	err := s.Each(func(info RequestInfo) error {
+		out = append(out, info)
+		return nil
+	})
+	return out, err
+}
+
+func (s *sqliteStore) Each(fn func(RequestInfo) error) error {
+	rows, err := s.db.Query(`SELECT id, data FROM requests ORDER BY id DESC`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return err
+		}
+		var info RequestInfo
+		if err := json.Unmarshal([]byte(data), &info); err != nil {
+			return err
+		}
+		info.ID = id
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqliteStore) Get(id int) (RequestInfo, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM requests WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RequestInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return RequestInfo{}, err
+	}
+	var info RequestInfo
+	if err := json.Unmarshal([]byte(data), &info); err != nil {
+		return RequestInfo{}, err
+	}
+	info.ID = id
+	return info, nil
+}
+
+func (s *sqliteStore) Update(id int, fn func(*RequestInfo)) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var data string
+	err = tx.QueryRow(`SELECT data FROM requests WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	var info RequestInfo
+	if err := json.Unmarshal([]byte(data), &info); err != nil {
+		return err
+	}
+	info.ID = id
+	fn(&info)
+	updated, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE requests SET data = ? WHERE id = ?`, string(updated), id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Delete(id int) error {
+	res, err := s.db.Exec(`DELETE FROM requests WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqliteStore) Count() (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM requests`).Scan(&n)
+	return n, err
+}
+
+func (s *sqliteStore) Size() (int64, error) {
+	var n int64
+	err := s.db.QueryRow(`SELECT COALESCE(SUM(LENGTH(data)), 0) FROM requests`).Scan(&n)
+	return n, err
+}
+
+func (s *sqliteStore) Clear() error {
+	_, err := s.db.Exec(`DELETE FROM requests`)
+	return err
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// tallyRefresh is how often a tallyStore counts its backend again, catching
+// up with other instances writing to a shared postgres or redis, and with
+// writes that landed while it last counted
+const tallyRefresh = time.Minute
+
+// binTally is what a store holds for one bin
+type binTally struct {
+	unpinned int   // captures counting towards MaxRequests
+	bytes    int64 // approximate, as counted for --bin-max-storage
+}
+
+// tallyStore wraps a Store and keeps running per-bin counts and sizes, so
+// quotas, retention caps and --max-memory, checked on every webhook, don't
+// scan the store. It counts the backend when first asked, again every
+// tallyRefresh in the background, and straight away after a change it can't
+// follow, such as a bin's captures moving to another name. Counting and
+// backend writes happen outside mu, so writes don't wait on each other.
+type tallyStore struct {
+	Store
+	mu    sync.Mutex
+	bins  map[string]*binTally // nil until counted
+	total binTally             // of every bin
+	// ratio is the backend's Size over total.bytes when last counted, as
+	// compression, encryption and spilling make them differ
+	ratio   float64
+	counted time.Time
+	// voided is bumped by changes a count in progress would undo, such as a
+	// clear, so its result is thrown away
+	voided int
+	// counting is held while the backend is counted, so only one count runs
+	counting sync.Mutex
+}
+
+func newTallyStore(inner Store) *tallyStore {
+	return &tallyStore{Store: inner}
+}
+
+// tally returns what s holds for bin, or for every bin when all is set,
+// counting the store first if needed
+func (s *tallyStore) tally(bin string, all bool) (binTally, error) {
+	s.mu.Lock()
+	uncounted, due := s.bins == nil, time.Since(s.counted) >= tallyRefresh
+	s.mu.Unlock()
+	switch {
+	case uncounted:
+		if err := s.count(true); err != nil {
+			return binTally{}, err
+		}
+	case due:
+		go s.count(false)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if all {
+		return s.total, nil
+	}
+	if t := s.bins[bin]; t != nil {
+		return *t, nil
+	}
+	return binTally{}, nil
+}
+
+// count counts the backend afresh. Unless wait is set it gives way to a
+// count already running. Writes made while it scans may be missed, until the
+// next count.
+func (s *tallyStore) count(wait bool) error {
+	if !wait {
+		if !s.counting.TryLock() {
+			return nil
+		}
+	} else {
+		s.counting.Lock()
+	}
+	defer s.counting.Unlock()
+	s.mu.Lock()
+	if wait && s.bins != nil {
+		// Counted while this waited its turn
+		s.mu.Unlock()
+		return nil
+	}
+	s.counted = time.Now()
+	voided := s.voided
+	s.mu.Unlock()
+	counted, total := map[string]*binTally{}, binTally{}
+	err := s.Store.Each(func(info RequestInfo) error {
+		countInto(counted, &total, info, 1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	size, err := s.Store.Size()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ratio = 1
+	if total.bytes > 0 {
+		s.ratio = float64(size) / float64(total.bytes)
+	}
+	if s.voided == voided {
+		s.bins, s.total = counted, total
+	}
+	return nil
+}
+
+// countInto adds info to its bin's tally in bins and to total, or takes it
+// away when sign is -1, dropping bins left empty
+func countInto(bins map[string]*binTally, total *binTally, info RequestInfo, sign int) {
+	t := bins[info.Bin]
+	if t == nil {
+		t = &binTally{}
+		bins[info.Bin] = t
+	}
+	size := int64(sign) * approxSize(info)
+	if !info.Pinned {
+		t.unpinned += sign
+		total.unpinned += sign
+	}
+	t.bytes += size
+	total.bytes += size
+	if t.unpinned <= 0 && t.bytes <= 0 {
+		delete(bins, info.Bin)
+	}
+}
+
+// Size estimates the backend's Size from the running byte total
+func (s *tallyStore) Size() (int64, error) {
+	t, err := s.tally("", true)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(float64(t.bytes) * s.ratio), nil
+}
+
+func (s *tallyStore) Add(info *RequestInfo) error {
+	if err := s.Store.Add(info); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bins != nil {
+		countInto(s.bins, &s.total, *info, 1)
+	}
+	return nil
+}
+
+func (s *tallyStore) Update(id int, fn func(*RequestInfo)) error {
+	var before, after RequestInfo
+	err := s.Store.Update(id, func(info *RequestInfo) {
+		before = *info
+		fn(info)
+		after = *info
+	})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bins == nil {
+		return nil
+	}
+	switch {
+	case after.Bin != before.Bin:
+		// fn sees the stored form, which isn't what's counted; count afresh
+		s.bins = nil
+		s.voided++
+	case after.Pinned != before.Pinned:
+		t := s.bins[after.Bin]
+		if t == nil {
+			t = &binTally{}
+			s.bins[after.Bin] = t
+		}
+		if after.Pinned {
+			t.unpinned--
+			s.total.unpinned--
+		} else {
+			t.unpinned++
+			s.total.unpinned++
+		}
+	}
+	return nil
+}
+
+func (s *tallyStore) Delete(id int) error {
+	s.mu.Lock()
+	counted := s.bins != nil
+	s.mu.Unlock()
+	var info RequestInfo
+	var err error
+	if counted {
+		if info, err = s.Store.Get(id); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	if err := s.Store.Delete(id); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bins != nil && info.ID != 0 {
+		countInto(s.bins, &s.total, info, -1)
+	}
+	return nil
+}
+
+func (s *tallyStore) Clear() error {
+	if err := s.Store.Clear(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bins, s.total, s.counted = map[string]*binTally{}, binTally{}, time.Now()
+	s.voided++
+	return nil
+}
+
+// binTotals returns how many unpinned captures s holds in bin and roughly how
+// many bytes all of them take, from a tallyStore's running count or else a
+// scan
+func binTotals(s Store, bin string) (unpinned int, bytes int64) {
+	return totals(s, bin, false)
+}
+
+// storeTotals is binTotals for every bin together
+func storeTotals(s Store) (unpinned int, bytes int64) {
+	return totals(s, "", true)
+}
+
+func totals(s Store, bin string, all bool) (unpinned int, bytes int64) {
+	if ts, ok := s.(*tallyStore); ok {
+		if t, err := ts.tally(bin, all); err == nil {
+			return t.unpinned, t.bytes
+		}
+	}
+	s.Each(func(info RequestInfo) error {
+		if all || info.Bin == bin {
+			if !info.Pinned {
+				unpinned++
+			}
+			bytes += approxSize(info)
+		}
+		return nil
+	})
+	return unpinned, bytes
+}
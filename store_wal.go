@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// walEntry is one line of the append log
+type walEntry struct {
+	Op      string       `json:"op"` // "add", "update", "delete" or "clear"
+	ID      int          `json:"id,omitempty"`
+	Request *RequestInfo `json:"request,omitempty"`
+}
+
+// walCompactRatio and walCompactMin decide when a running walStore compacts
+// its log: once it holds this many times more entries than there are
+// requests, and at least walCompactMin, so retention churn can't grow the
+// file without bound
+const (
+	walCompactRatio = 4
+	walCompactMin   = 1000
+)
+
+// walStore gives the memory store durability by appending every mutation to a
+// log file, synced before the call returns. On startup the log is replayed and
+// compacted down to the surviving requests, and again whenever it outgrows
+// them.
+type walStore struct {
+	*memoryStore
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	entries int // in the log since it was last compacted
+}
+
+func newWALStore(path string) (*walStore, error) {
+	mem := newMemoryStore()
+	if err := replayWAL(path, mem); err != nil {
+		return nil, fmt.Errorf("replay %s: %w", path, err)
+	}
+	if err := compactWAL(path, mem); err != nil {
+		return nil, fmt.Errorf("compact %s: %w", path, err)
+	}
+	s := &walStore{memoryStore: mem, path: path}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens the compacted log for appending
+func (s *walStore) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	s.f = f
+	s.entries, _ = s.memoryStore.Count()
+	return nil
+}
+
+func replayWAL(path string, mem *memoryStore) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1<<30)
+	for sc.Scan() {
+		var e walEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			// A torn final line from a crash mid-write is expected; stop there
+			break
+		}
+		switch e.Op {
+		case "add":
+			if e.Request != nil {
+				mem.restore(*e.Request)
+			}
+		case "update":
+			if e.Request != nil {
+				mem.Update(e.Request.ID, func(info *RequestInfo) {
+					// Keep the interned body rather than the logged copy
+					body := info.Body
+					*info = *e.Request
+					info.Body = body
+				})
+			}
+		case "delete":
+			mem.Delete(e.ID)
+		case "clear":
+			mem.Clear()
+		}
+	}
+	return sc.Err()
+}
+
+// compactWAL rewrites the log as one add entry per request currently in mem
+func compactWAL(path string, mem *memoryStore) error {
+	list, _ := mem.List()
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := len(list) - 1; i >= 0; i-- {
+		if err := enc.Encode(walEntry{Op: "add", Request: &list[i]}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// append writes e to the log; callers hold s.mu so log order matches the
+// order mutations were applied in
+func (s *walStore) append(e walEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := s.f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := s.f.Sync(); err != nil {
+		return err
+	}
+	s.entries++
+	if live, _ := s.memoryStore.Count(); s.entries >= max(walCompactMin, walCompactRatio*live) {
+		s.compact(live)
+	}
+	return nil
+}
+
+// compact rewrites the log down to the live requests in memory; callers hold
+// s.mu. The mutation just logged is already durable, so a failure is only
+// logged, and retried once the log has grown as much again.
+func (s *walStore) compact(live int) {
+	if err := compactWAL(s.path, s.memoryStore); err != nil {
+		os.Remove(s.path + ".tmp")
+		log.Printf("Failed to compact %s: %v", s.path, err)
+		s.entries = live
+		return
+	}
+	s.f.Close()
+	if err := s.open(); err != nil {
+		// Appends fail, and report it, until the log can be opened
+		log.Printf("Failed to reopen %s: %v", s.path, err)
+	}
+}
+
+func (s *walStore) Add(info *RequestInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.memoryStore.Add(info); err != nil {
+		return err
+	}
+	return s.append(walEntry{Op: "add", Request: info})
+}
+
+func (s *walStore) Update(id int, fn func(*RequestInfo)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var updated RequestInfo
+	err := s.memoryStore.Update(id, func(info *RequestInfo) {
+		fn(info)
+		updated = *info
+	})
+	if err != nil {
+		return err
+	}
+	return s.append(walEntry{Op: "update", Request: &updated})
+}
+
+func (s *walStore) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.memoryStore.Delete(id); err != nil {
+		return err
+	}
+	return s.append(walEntry{Op: "delete", ID: id})
+}
+
+func (s *walStore) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.memoryStore.Clear(); err != nil {
+		return err
+	}
+	return s.append(walEntry{Op: "clear"})
+}
+
+func (s *walStore) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWALCompactsWhileRunning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requests.wal")
+	s, err := newWALStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Retention keeps ten requests while thousands come and go
+	var ids []int
+	for i := range 3 * walCompactMin {
+		info := RequestInfo{Method: "POST", URL: "/hook", Body: "x"}
+		if err := s.Add(&info); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, info.ID)
+		if len(ids) > 10 {
+			if err := s.Delete(ids[0]); err != nil {
+				t.Fatal(err)
+			}
+			ids = ids[1:]
+		}
+		if i == 20 {
+			// A pinned request outlives the rest
+			s.Update(info.ID, func(info *RequestInfo) { info.Pinned = true })
+			ids = ids[:len(ids)-1]
+		}
+	}
+	s.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines > walCompactMin+20 {
+		t.Errorf("log holds %d entries for 11 requests", lines)
+	}
+
+	s, err = newWALStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	list, _ := s.List()
+	if len(list) != 11 {
+		t.Fatalf("replayed %d requests, want 11", len(list))
+	}
+	if !list[len(list)-1].Pinned || list[0].ID != ids[len(ids)-1] {
+		t.Errorf("replayed %d..%d, pinned %t", list[len(list)-1].ID, list[0].ID, list[len(list)-1].Pinned)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// streamHeartbeat is how often an idle event stream sends a comment line, so
+// proxies don't time the connection out
+const streamHeartbeat = 15 * time.Second
+
+// streamHandler sends each new capture matching the list filters as a
+// Server-Sent Event named "request", with the capture ID as the event ID.
+// Reconnecting clients that send Last-Event-ID (or ?since_id=) first receive
+// the matching captures they missed.
+func streamHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		q.Set("since_id", id)
+	}
+	filter, err := parseFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rc := http.NewResponseController(w)
+
+	// Subscribe before replaying so nothing slips between the two
+	ch := captures.subscribe()
+	defer captures.unsubscribe(ch)
+	var missed []RequestInfo
+	if filter.SinceID > 0 {
+		if missed, err = listRequests(filter); err != nil {
+			http.Error(w, "Failed to list requests", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	last := filter.SinceID
+	send := func(info RequestInfo) error {
+		if info.ID <= last || !filter.Match(info) {
+			return nil
+		}
+		last = info.ID
+		data, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\nevent: request\ndata: %s\n\n", strconv.Itoa(info.ID), data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	// Replay oldest first so event IDs keep increasing
+	for i := len(missed) - 1; i >= 0; i-- {
+		if err := send(missed[i]); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case ev := <-ch:
+			if ev.Type != "request" {
+				continue
+			}
+			if err := send(*ev.Request); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
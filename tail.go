@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tailRetry is how long tail waits before reconnecting to a lost stream
+const tailRetry = 2 * time.Second
+
+// tailMaxEvent bounds a single stream event, which carries a whole body
+const tailMaxEvent = 64 << 20
+
+// runTail implements "webhook-host tail": it follows a running instance's
+// event stream and prints each capture as it arrives, one line per request
+// or, with --json, as indented JSON
+func runTail(args []string) {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	base := fs.String("url", envOr("WEBHOOK_HOST_URL", "http://localhost:8080"), "address of the webhook-host instance to follow")
+	full := fs.Bool("json", false, "print every capture in full as indented JSON")
+	method := fs.String("method", "", "only show requests with this method")
+	path := fs.String("path", "", "only show requests whose path starts with this prefix")
+	fs.Parse(args)
+
+	q := url.Values{}
+	if *method != "" {
+		q.Set("method", *method)
+	}
+	if *path != "" {
+		q.Set("path", *path)
+	}
+	streamURL := strings.TrimSuffix(*base, "/") + apiPrefix + "/stream"
+	if len(q) > 0 {
+		streamURL += "?" + q.Encode()
+	}
+
+	show := func(info RequestInfo) {
+		if *full {
+			out, _ := json.MarshalIndent(info, "", "  ")
+			fmt.Printf("%s\n", out)
+			return
+		}
+		fmt.Printf("%s #%d %-6s %s %dB from %s\n",
+			info.Timestamp.Local().Format("15:04:05"), info.ID, info.Method, info.URL, info.BodySize, senderIP(info))
+	}
+
+	lastID := ""
+	for {
+		err := followStream(streamURL, &lastID, show)
+		log.Printf("Stream from %s ended: %v; reconnecting in %s", *base, err, tailRetry)
+		time.Sleep(tailRetry)
+	}
+}
+
+// followStream reads Server-Sent Events from streamURL until the connection
+// fails, passing each capture to fn. lastID tracks the newest event seen, so
+// a reconnect resumes without gaps.
+func followStream(streamURL string, lastID *string, fn func(RequestInfo)) error {
+	req, err := http.NewRequest(http.MethodGet, streamURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if *lastID != "" {
+		req.Header.Set("Last-Event-ID", *lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64<<10), tailMaxEvent)
+	var id, event string
+	var data strings.Builder
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			// A blank line ends the event
+			if event == "request" && data.Len() > 0 {
+				var info RequestInfo
+				if err := json.Unmarshal([]byte(data.String()), &info); err != nil {
+					return fmt.Errorf("decode event %s: %w", id, err)
+				}
+				fn(info)
+				*lastID = strconv.Itoa(info.ID)
+			}
+			id, event = "", ""
+			data.Reset()
+		case strings.HasPrefix(line, ":"):
+			// Keep-alive comment
+		case strings.HasPrefix(line, "id: "):
+			id = line[4:]
+		case strings.HasPrefix(line, "event: "):
+			event = line[7:]
+		case strings.HasPrefix(line, "data: "):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(line[6:])
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// TLSInfo describes the TLS connection a request arrived on
+type TLSInfo struct {
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipher_suite"`
+	ServerName  string `json:"server_name,omitempty"` // SNI sent by the client
+	ALPN        string `json:"alpn,omitempty"`        // negotiated application protocol, such as h2
+	Resumed     bool   `json:"resumed,omitempty"`     // the session was resumed from an earlier handshake
+
+	ClientCert  *ClientCert     `json:"client_cert,omitempty"` // presented on mTLS connections
+	Fingerprint *TLSFingerprint `json:"fingerprint,omitempty"`
+}
+
+// ClientCert describes the leaf certificate a client presented
+type ClientCert struct {
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	Serial      string    `json:"serial"`
+	Fingerprint string    `json:"fingerprint_sha256"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	DNSNames    []string  `json:"dns_names,omitempty"`
+	Emails      []string  `json:"emails,omitempty"`
+	// Verified is set when the chain checked out against --tls-client-ca
+	Verified bool `json:"verified"`
+}
+
+// newTLSInfo returns the details of cs and the connection's fingerprint, or
+// nil for a plain HTTP request
+func newTLSInfo(cs *tls.ConnectionState, fp *TLSFingerprint) *TLSInfo {
+	if cs == nil {
+		return nil
+	}
+	info := &TLSInfo{
+		Version:     tls.VersionName(cs.Version),
+		CipherSuite: tls.CipherSuiteName(cs.CipherSuite),
+		ServerName:  cs.ServerName,
+		ALPN:        cs.NegotiatedProtocol,
+		Resumed:     cs.DidResume,
+		Fingerprint: fp,
+	}
+	if len(cs.PeerCertificates) > 0 {
+		c := cs.PeerCertificates[0]
+		sum := sha256.Sum256(c.Raw)
+		info.ClientCert = &ClientCert{
+			Subject:     c.Subject.String(),
+			Issuer:      c.Issuer.String(),
+			Serial:      c.SerialNumber.String(),
+			Fingerprint: hex.EncodeToString(sum[:]),
+			NotBefore:   c.NotBefore,
+			NotAfter:    c.NotAfter,
+			DNSNames:    c.DNSNames,
+			Emails:      c.EmailAddresses,
+			Verified:    len(cs.VerifiedChains) > 0,
+		}
+	}
+	return info
+}
+
+// clientAuthType maps --tls-client-auth to a tls.ClientAuthType. Without a
+// CA, presented certificates are recorded but not verified.
+func clientAuthType(mode string, verify bool) (tls.ClientAuthType, error) {
+	switch mode {
+	case "none":
+		return tls.NoClientCert, nil
+	case "request":
+		if verify {
+			return tls.VerifyClientCertIfGiven, nil
+		}
+		return tls.RequestClientCert, nil
+	case "require":
+		if verify {
+			return tls.RequireAndVerifyClientCert, nil
+		}
+		return tls.RequireAnyClientCert, nil
+	}
+	return 0, fmt.Errorf("invalid client auth %q; use none, request or require", mode)
+}
+
+// loadCertPool reads the PEM certificates in path
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no PEM certificates in " + path)
+	}
+	return pool, nil
+}
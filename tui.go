@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// tuiHelp is shown in the status bar
+const tuiHelp = " [::b]↑/↓[::-] select  [::b]Tab[::-] switch pane  [::b]d[::-] delete  [::b]p[::-] pin  [::b]q[::-] quit"
+
+// runTUI shows the captures in st in the terminal, with a list on the left
+// and the selected request on the right, refreshing as changes arrive. It
+// returns once the user quits. Nothing else may write to the terminal while
+// it runs, so log output is discarded until then.
+func runTUI(st Store, addr string) error {
+	logOutput := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(logOutput)
+
+	app := tview.NewApplication()
+	list := tview.NewList().ShowSecondaryText(false).SetHighlightFullLine(true)
+	list.SetBorder(true).SetTitle(" Requests ")
+	detail := tview.NewTextView().SetDynamicColors(true).SetWrap(true)
+	detail.SetBorder(true).SetTitle(" Details ")
+	status := tview.NewTextView().SetDynamicColors(true)
+
+	var requests []RequestInfo
+	shownID := 0
+	refreshing := false
+	showDetail := func(i int) {
+		if i < 0 || i >= len(requests) {
+			detail.Clear()
+			shownID = 0
+			return
+		}
+		info := requests[i]
+		// The list only holds previews of spilled bodies
+		if info.BodyRef != "" {
+			if full, err := st.Get(info.ID); err == nil {
+				info = full
+			}
+		}
+		// Keep the reader's place when the same request is redrawn
+		row, col := detail.GetScrollOffset()
+		detail.SetText(tuiDetail(info))
+		if info.ID == shownID {
+			detail.ScrollTo(row, col)
+		} else {
+			detail.ScrollToBeginning()
+		}
+		shownID = info.ID
+	}
+
+	refresh := func() {
+		all, err := st.List()
+		if err != nil {
+			status.SetText(fmt.Sprintf("[red]Failed to list requests: %v", err))
+			return
+		}
+		selected := -1
+		if i := list.GetCurrentItem(); i >= 0 && i < len(requests) {
+			selected = requests[i].ID
+		}
+		requests = all
+		refreshing = true
+		list.Clear()
+		current := 0
+		for i, info := range requests {
+			pin := " "
+			if info.Pinned {
+				pin = "*"
+			}
+			list.AddItem(fmt.Sprintf("%s %s [::b]%-6s[::-] %s",
+				pin, info.Timestamp.Local().Format("15:04:05"), tview.Escape(info.Method), tview.Escape(info.URL)), "", 0, nil)
+			if info.ID == selected {
+				current = i
+			}
+		}
+		list.SetCurrentItem(current)
+		refreshing = false
+		showDetail(current)
+		status.SetText(fmt.Sprintf(" %d requests, listening on %s |%s", len(requests), addr, tuiHelp))
+	}
+	list.SetChangedFunc(func(i int, _, _ string, _ rune) {
+		if !refreshing {
+			showDetail(i)
+		}
+	})
+
+	selectedRequest := func() (RequestInfo, bool) {
+		i := list.GetCurrentItem()
+		if i < 0 || i >= len(requests) {
+			return RequestInfo{}, false
+		}
+		return requests[i], true
+	}
+	app.SetInputCapture(func(ev *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case ev.Key() == tcell.KeyTab:
+			if list.HasFocus() {
+				app.SetFocus(detail)
+			} else {
+				app.SetFocus(list)
+			}
+			return nil
+		case ev.Rune() == 'q':
+			app.Stop()
+			return nil
+		case ev.Rune() == 'd':
+			if info, ok := selectedRequest(); ok {
+				st.Delete(info.ID)
+			}
+			return nil
+		case ev.Rune() == 'p':
+			if info, ok := selectedRequest(); ok {
+				st.Update(info.ID, func(i *RequestInfo) { i.Pinned = !i.Pinned })
+			}
+			return nil
+		}
+		return ev
+	})
+
+	// Redraw on store changes, once per burst
+	ch := captures.subscribe()
+	defer captures.unsubscribe(ch)
+	go func() {
+		for range ch {
+			for len(ch) > 0 {
+				<-ch
+			}
+			app.QueueUpdateDraw(refresh)
+		}
+	}()
+
+	refresh()
+	panes := tview.NewFlex().
+		AddItem(list, 0, 2, true).
+		AddItem(detail, 0, 3, false)
+	root := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(panes, 0, 1, true).
+		AddItem(status, 1, 0, false)
+	return app.SetRoot(root, true).Run()
+}
+
+// tuiDetail formats a capture for the detail pane
+func tuiDetail(info RequestInfo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[yellow::b]%s[-::-] %s\n", tview.Escape(info.Method), tview.Escape(info.URL))
+	from := info.RemoteAddr
+	if info.ClientIP != "" {
+		from = info.ClientIP + " via " + info.RemoteAddr
+	}
+	if info.Hostname != "" {
+		from += " (" + info.Hostname + ")"
+	}
+	fmt.Fprintf(&b, "#%d at %s from %s\n", info.ID, info.Timestamp.Local().Format("2006-01-02 15:04:05"), tview.Escape(from))
+	if g := info.Geo; g != nil {
+		fmt.Fprintf(&b, "Location: %s\n", tview.Escape(geoSummary(g)))
+	}
+	if info.Notes != "" {
+		fmt.Fprintf(&b, "Notes: %s\n", tview.Escape(info.Notes))
+	}
+	if len(info.Tags) > 0 {
+		fmt.Fprintf(&b, "Tags: %s\n", tview.Escape(strings.Join(info.Tags, ", ")))
+	}
+
+	b.WriteString("\n[::b]Headers[::-]\n")
+	names := make([]string, 0, len(info.Headers))
+	for k := range info.Headers {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	for _, k := range names {
+		for _, v := range info.Headers[k] {
+			fmt.Fprintf(&b, "[aqua]%s[-]: %s\n", tview.Escape(k), tview.Escape(v))
+		}
+	}
+
+	if len(info.Files) > 0 {
+		b.WriteString("\n[::b]Files[::-]\n")
+		for _, f := range info.Files {
+			fmt.Fprintf(&b, "[aqua]%s[-]: %s (%s, %d bytes)\n", tview.Escape(f.Field), tview.Escape(f.Filename), tview.Escape(f.ContentType), f.Size)
+		}
+	}
+
+	b.WriteString("\n[::b]Body[::-]\n")
+	if info.DecodedFrom != "" {
+		fmt.Fprintf(&b, "(decoded from %s, %d bytes compressed)\n", tview.Escape(info.DecodedFrom), info.EncodedSize)
+	}
+	if info.Truncated {
+		fmt.Fprintf(&b, "(truncated at %d bytes by --max-body-size)\n", info.BodySize)
+	}
+	body := info.Body
+	if info.DecodedBody != nil {
+		fmt.Fprintf(&b, "(%d bytes of %s, shown as JSON)\n", info.BodySize, tview.Escape(info.DecodedAs))
+		body = string(info.DecodedBody)
+	} else if info.BodyEncoding != "" {
+		fmt.Fprintf(&b, "(binary, %d bytes, shown as %s)\n", info.BodySize, info.BodyEncoding)
+	}
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, []byte(body), "", "  ") == nil {
+		body = pretty.String()
+	}
+	if body == "" {
+		body = "(empty)"
+	}
+	b.WriteString(tview.Escape(body))
+	return b.String()
+}
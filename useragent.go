@@ -0,0 +1,132 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// UserAgent is a parsed User-Agent header. Product is the client that sent
+// the request, such as GitHub-Hookshot, Stripe or curl; for browsers, which
+// all claim to be Mozilla, it's the browser itself.
+type UserAgent struct {
+	Product string `json:"product"`
+	Version string `json:"version,omitempty"`
+	OS      string `json:"os,omitempty"`
+	// Comment is the product's parenthesised comment, often a contact URL
+	Comment string `json:"comment,omitempty"`
+}
+
+// uaProduct is one "name/version (comment)" entry of a User-Agent
+type uaProduct struct {
+	name, version, comment string
+}
+
+// browserTokens are the products that identify a browser behind its
+// Mozilla-compatible prefix, most specific first since Chrome also claims
+// to be Safari and Edge to be Chrome
+var browserTokens = []string{"Edg", "OPR", "Firefox", "Chrome", "Safari"}
+
+// parseUserAgent returns the parts of a User-Agent header, or nil when it's
+// empty
+func parseUserAgent(s string) *UserAgent {
+	products := splitProducts(s)
+	if len(products) == 0 {
+		return nil
+	}
+	client := products[0]
+	if client.name == "Mozilla" {
+	browsers:
+		for _, token := range browserTokens {
+			for _, p := range products[1:] {
+				if p.name == token {
+					client.name, client.version = p.name, p.version
+					break browsers
+				}
+			}
+		}
+		// Safari's own token carries the WebKit build; its release is in Version/
+		for _, p := range products[1:] {
+			if client.name == "Safari" && p.name == "Version" {
+				client.version = p.version
+			}
+		}
+	}
+	return &UserAgent{Product: client.name, Version: client.version, OS: detectOS(products[0].comment), Comment: products[0].comment}
+}
+
+// splitProducts tokenises a User-Agent into products (RFC 9110 section
+// 10.1.5). Senders that separate name and version with a space, like
+// "Slackbot 1.0", are read as one product when the second word starts with
+// a digit.
+func splitProducts(s string) []uaProduct {
+	var out []uaProduct
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] == '(' {
+			end := strings.IndexByte(s, ')')
+			if end < 0 {
+				end = len(s) - 1
+			}
+			comment := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+			if len(out) > 0 && out[len(out)-1].comment == "" {
+				out[len(out)-1].comment = comment
+			}
+			continue
+		}
+		end := strings.IndexAny(s, " (")
+		if end < 0 {
+			end = len(s)
+		}
+		token := s[:end]
+		s = s[end:]
+		if n := len(out); n > 0 && out[n-1].version == "" && out[n-1].comment == "" && token[0] >= '0' && token[0] <= '9' {
+			out[n-1].version = token
+			continue
+		}
+		name, version, _ := strings.Cut(token, "/")
+		out = append(out, uaProduct{name: name, version: version})
+	}
+	return out
+}
+
+var (
+	windowsOS = regexp.MustCompile(`Windows NT ([\d.]+)`)
+	androidOS = regexp.MustCompile(`Android ([\d.]+)`)
+	iOS       = regexp.MustCompile(`(?:iPhone|CPU) OS ([\d_]+)`)
+	macOS     = regexp.MustCompile(`Mac OS X ([\d_.]+)`)
+)
+
+// detectOS names the operating system described in a product comment, such
+// as "Windows NT 10.0; Win64; x64", or returns ""
+func detectOS(comment string) string {
+	if m := windowsOS.FindStringSubmatch(comment); m != nil {
+		return "Windows NT " + m[1]
+	}
+	if m := androidOS.FindStringSubmatch(comment); m != nil {
+		return "Android " + m[1]
+	}
+	if m := iOS.FindStringSubmatch(comment); m != nil && (strings.Contains(comment, "iPhone") || strings.Contains(comment, "iPad")) {
+		return "iOS " + strings.ReplaceAll(m[1], "_", ".")
+	}
+	if m := macOS.FindStringSubmatch(comment); m != nil {
+		return "macOS " + strings.ReplaceAll(m[1], "_", ".")
+	}
+	if strings.Contains(comment, "CrOS") {
+		return "ChromeOS"
+	}
+	for _, name := range []string{"Linux", "FreeBSD", "Darwin"} {
+		if strings.Contains(comment, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// requestAgent returns a capture's parsed User-Agent, parsing the header for
+// captures stored before it was kept
+func requestAgent(info RequestInfo) *UserAgent {
+	if info.UserAgent != nil {
+		return info.UserAgent
+	}
+	return parseUserAgent(info.Headers.Get("User-Agent"))
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User is an account on a shared instance. Bins a user creates are theirs,
+// readable with their login as well as the bin's read token.
+type User struct {
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash,omitempty"`
+	Provider     string    `json:"provider,omitempty"` // the login provider of an account made through one
+	Subject      string    `json:"subject,omitempty"`  // the provider's ID for the account
+	Role         role      `json:"role,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// usernamePattern is what signup accepts as a user name
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
+// errUserExists is returned by add for a taken user name
+var errUserExists = errors.New("user name taken")
+
+// userRegistry holds the accounts, and keeps them in a JSON file when a path
+// is set
+type userRegistry struct {
+	mu     sync.Mutex
+	path   string
+	nextID int
+	users  []User
+	signup bool // whether anyone may create an account
+}
+
+var users = &userRegistry{nextID: 1}
+
+// loadUsers reads the accounts saved at path, if any. An empty path keeps
+// them in memory only.
+func loadUsers(path string, signup bool) error {
+	r := users
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.path, r.signup = path, signup
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &r.users); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, u := range r.users {
+		r.nextID = max(r.nextID, u.ID+1)
+	}
+	return nil
+}
+
+// save writes the accounts to r.path; callers hold r.mu
+func (r *userRegistry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.users, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// add creates an account with role ro, failing with errUserExists if the
+// name, compared case-insensitively, is taken
+func (r *userRegistry) add(username, password string, ro role) (User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return User{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if slices.ContainsFunc(r.users, func(u User) bool { return strings.EqualFold(u.Username, username) }) {
+		return User{}, errUserExists
+	}
+	u := User{ID: r.nextID, Username: username, PasswordHash: string(hash), Role: ro, CreatedAt: time.Now()}
+	r.nextID++
+	r.users = append(r.users, u)
+	return u, r.save()
+}
+
+func (r *userRegistry) get(id int) (User, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.users, func(u User) bool { return u.ID == id })
+	if i < 0 {
+		return User{}, false
+	}
+	return r.users[i], true
+}
+
+// authenticate returns the account username and password log in to
+func (r *userRegistry) authenticate(username, password string) (User, bool) {
+	r.mu.Lock()
+	i := slices.IndexFunc(r.users, func(u User) bool { return strings.EqualFold(u.Username, username) })
+	var u User
+	if i >= 0 {
+		u = r.users[i]
+	}
+	r.mu.Unlock()
+	if i < 0 || u.PasswordHash == "" {
+		return User{}, false
+	}
+	return u, bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+func (u User) redacted() User {
+	u.PasswordHash = ""
+	return u
+}
+
+// loginInput is the body accepted by signup and login
+type loginInput struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// sessionResponse answers a signup or login. Token is the session cookie's
+// value, for API clients to send as a bearer token.
+type sessionResponse struct {
+	User  User   `json:"user"`
+	Token string `json:"token"`
+}
+
+// signupHandler creates an account from {"username": ..., "password": ...}
+// and logs it in, unless started with --signup=false
+func signupHandler(w http.ResponseWriter, r *http.Request) {
+	if !users.signup {
+		http.Error(w, "Signup disabled", http.StatusForbidden)
+		return
+	}
+	var in loginInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if !usernamePattern.MatchString(in.Username) {
+		http.Error(w, "Invalid username; use up to 64 letters, digits, dots, dashes and underscores", http.StatusBadRequest)
+		return
+	}
+	if len(in.Password) < 8 || len(in.Password) > 72 {
+		http.Error(w, "Invalid password; use 8 to 72 bytes", http.StatusBadRequest)
+		return
+	}
+	u, err := users.add(in.Username, in.Password, defaultRole)
+	if errors.Is(err, errUserExists) {
+		http.Error(w, "Username taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+	token := startSession(w, r, u.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sessionResponse{User: u.redacted(), Token: token})
+}
+
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	var in loginInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	u, ok := users.authenticate(in.Username, in.Password)
+	if !ok {
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+	token := startSession(w, r, u.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessionResponse{User: u.redacted(), Token: token})
+}
+
+// logoutHandler drops the session cookie. Bearer tokens stay valid until
+// they expire, as nothing is kept server-side.
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	endSession(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// meHandler returns the logged-in user
+func meHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := sessionUser(r)
+	if !ok {
+		http.Error(w, "Not logged in", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	u.Role = u.role()
+	json.NewEncoder(w).Encode(u.redacted())
+}
+
+// listBinsHandler returns the logged-in user's bins, oldest first
+func listBinsHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := sessionUser(r)
+	if !ok {
+		http.Error(w, "Not logged in", http.StatusUnauthorized)
+		return
+	}
+	list := []Bin{}
+	for _, b := range bins.all() {
+		if b.Owner == u.ID {
+			b.PasswordHash = ""
+			list = append(list, b)
+		}
+	}
+	slices.SortFunc(list, func(a, b Bin) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWaitTimeout = 30 * time.Second
+	maxWaitTimeout     = 5 * time.Minute
+)
+
+// waitHandler blocks until a capture matching the list filters and ?match=
+// arrives, then returns it, or answers 204 once ?timeout= (default 30s)
+// passes. match is a case-insensitive substring of the body, headers or URL.
+// With since_id, a matching capture that is already stored is returned
+// straight away, so a test can note the latest ID, trigger the provider and
+// wait without racing the webhook.
+func waitHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	timeout := defaultWaitTimeout
+	if v := q.Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxWaitTimeout {
+			http.Error(w, fmt.Sprintf("Invalid timeout; use a duration up to %s such as 30s", maxWaitTimeout), http.StatusBadRequest)
+			return
+		}
+		timeout = d
+	}
+	filter, err := parseFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lower := strings.ToLower(q.Get("match"))
+	matches := func(info RequestInfo) bool {
+		if !filter.Match(info) {
+			return false
+		}
+		return lower == "" || searchMatch(info, searchFields, func(s string) bool {
+			return strings.Contains(strings.ToLower(s), lower)
+		})
+	}
+
+	// Subscribe before looking at the store so nothing slips between the two
+	ch := captures.subscribe()
+	defer captures.unsubscribe(ch)
+
+	if filter.SinceID > 0 {
+		list, err := listRequests(filter)
+		if err == nil {
+			err = hydrateBodies(list)
+		}
+		if err != nil {
+			http.Error(w, "Failed to list requests", http.StatusInternalServerError)
+			return
+		}
+		// The oldest match is the next one after since_id
+		for i := len(list) - 1; i >= 0; i-- {
+			if matches(list[i]) {
+				writeWaitResult(w, list[i])
+				return
+			}
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case ev := <-ch:
+			if ev.Type == "request" && matches(*ev.Request) {
+				writeWaitResult(w, *ev.Request)
+				return
+			}
+		case <-timer.C:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeWaitResult(w http.ResponseWriter, info RequestInfo) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
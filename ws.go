@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPingInterval = 30 * time.Second
+	// wsPongTimeout must exceed wsPingInterval
+	wsPongTimeout = 60 * time.Second
+)
+
+// wsUpgrader keeps gorilla's same-origin check, so other sites can't open a
+// socket with a visitor's browser
+var wsUpgrader = websocket.Upgrader{}
+
+// wsFilterMessage is sent by a client to replace its connection's filter.
+// Query uses the list endpoint's filter parameters, such as
+// "method=POST&path=/stripe".
+type wsFilterMessage struct {
+	Type  string `json:"type"`
+	Query string `json:"query"`
+}
+
+// wsError reports a rejected client message without closing the socket
+type wsError struct {
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+// wsHandler pushes store changes to a WebSocket client as captureEvent JSON
+// messages. New captures are sent only when they match the connection's
+// filter, set from the list filter parameters on the URL and replaceable by
+// sending {"type": "filter", "query": "..."}. Updates, deletions and clears
+// are always sent so a viewer's list never shows stale entries.
+func wsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already answered the client
+		return
+	}
+	defer conn.Close()
+
+	ch := captures.subscribe()
+	defer captures.unsubscribe(ch)
+
+	// The reader owns incoming messages and hands filters and error replies
+	// to the writer loop below, the only goroutine writing to conn. The
+	// request context ends when the handler returns.
+	filters := make(chan Filter)
+	replies := make(chan wsError)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		})
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			f, err := parseWSFilter(data)
+			if err != nil {
+				select {
+				case replies <- wsError{Type: "error", Error: err.Error()}:
+				case <-r.Context().Done():
+					return
+				}
+				continue
+			}
+			select {
+			case filters <- f:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		var msg any
+		select {
+		case ev := <-ch:
+			if ev.Type == "request" && !filter.Match(*ev.Request) {
+				continue
+			}
+			if ev.Request != nil && (!filter.visible(*ev.Request) || !captureInScope(r, *ev.Request)) {
+				// Updates are otherwise always sent, but not from bins this
+				// client may not read, or outside the bin its credentials are
+				// for
+				continue
+			}
+			msg = ev
+		case f := <-filters:
+			if f.Bin != filter.Bin && (!canReadBin(r, f.Bin) || !inScope(r, f.Bin)) {
+				msg = wsError{Type: "error", Error: "bin needs its read token; reconnect with it"}
+				break
+			}
+			filter = f
+			continue
+		case reply := <-replies:
+			msg = reply
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+			continue
+		case <-done:
+			return
+		}
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
+
+// parseWSFilter reads a wsFilterMessage
+func parseWSFilter(data []byte) (Filter, error) {
+	var msg wsFilterMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return Filter{}, fmt.Errorf("invalid message: %w", err)
+	}
+	if msg.Type != "filter" {
+		return Filter{}, fmt.Errorf("unknown message type %q", msg.Type)
+	}
+	q, err := url.ParseQuery(msg.Query)
+	if err != nil {
+		return Filter{}, fmt.Errorf("invalid filter query: %w", err)
+	}
+	return parseFilter(q)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// XMLInfo describes an XML body
+type XMLInfo struct {
+	Root      string `json:"root"` // the document element, as written
+	Namespace string `json:"namespace,omitempty"`
+	// SOAPAction comes from the SOAPAction header (SOAP 1.1) or the
+	// Content-Type action parameter (SOAP 1.2); SOAPOperation is the first
+	// element inside the envelope's Body
+	SOAPAction    string `json:"soap_action,omitempty"`
+	SOAPOperation string `json:"soap_operation,omitempty"`
+	// Error says why a body that looked like XML isn't well-formed
+	Error  string `json:"error,omitempty"`
+	Pretty string `json:"pretty,omitempty"` // the body re-indented, when well-formed
+}
+
+// soapEnvelopes are the SOAP 1.1 and 1.2 envelope namespaces
+var soapEnvelopes = []string{"http://schemas.xmlsoap.org/soap/envelope/", "http://www.w3.org/2003/05/soap-envelope"}
+
+// parseXML describes body when its Content-Type is XML, or when it's untyped
+// and starts like XML. It returns nil otherwise.
+func parseXML(r *http.Request, body []byte) *XMLInfo {
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isXML := mediaType == "text/xml" || mediaType == "application/xml" || strings.HasSuffix(mediaType, "+xml")
+	untyped := mediaType == "" || mediaType == "text/plain" || mediaType == "application/octet-stream"
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || !isXML && !(untyped && trimmed[0] == '<') {
+		return nil
+	}
+
+	info := &XMLInfo{SOAPAction: strings.Trim(r.Header.Get("SOAPAction"), `"`)}
+	if info.SOAPAction == "" && mediaType == "application/soap+xml" {
+		info.SOAPAction = params["action"]
+	}
+
+	// Namespaces are resolved here for the metadata, and left as written
+	// for the root name and the pretty rendering
+	dec := newXMLDecoder(body)
+	depth, soap, bodyDepth := 0, false, 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			info.Error = err.Error()
+			return info
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 {
+				info.Root, info.Namespace = rawRootName(body), t.Name.Space
+				soap = t.Name.Local == "Envelope" && slices.Contains(soapEnvelopes, t.Name.Space)
+			}
+			if soap && depth == 2 && t.Name.Local == "Body" {
+				bodyDepth = depth
+			}
+			if soap && bodyDepth > 0 && depth == bodyDepth+1 && info.SOAPOperation == "" {
+				info.SOAPOperation = t.Name.Local
+			}
+		case xml.EndElement:
+			if depth == bodyDepth {
+				bodyDepth = 0
+			}
+			depth--
+		}
+	}
+	if info.Root == "" {
+		info.Error = "no root element"
+		return info
+	}
+	if pretty, err := indentXML(body); err == nil {
+		info.Pretty = pretty
+	}
+	return info
+}
+
+// newXMLDecoder returns a decoder for body that also reads documents
+// declaring legacy encodings such as ISO-8859-1
+func newXMLDecoder(body []byte) *xml.Decoder {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.CharsetReader = charset.NewReaderLabel
+	return dec
+}
+
+// rawRootName returns the prefixed name of the first element in body
+func rawRootName(body []byte) string {
+	dec := newXMLDecoder(body)
+	for {
+		tok, err := dec.RawToken()
+		if err != nil {
+			return ""
+		}
+		if t, ok := tok.(xml.StartElement); ok {
+			return rawName(t.Name)
+		}
+	}
+}
+
+func rawName(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
+
+// indentXML re-encodes body with two-space indentation, keeping prefixes and
+// namespace declarations exactly as written
+func indentXML(body []byte) (string, error) {
+	dec := newXMLDecoder(body)
+	var out strings.Builder
+	enc := xml.NewEncoder(&out)
+	enc.Indent("", "  ")
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			// The encoder would otherwise turn prefixes into default
+			// namespace declarations
+			t.Name = xml.Name{Local: rawName(t.Name)}
+			attrs := make([]xml.Attr, len(t.Attr))
+			for i, a := range t.Attr {
+				attrs[i] = xml.Attr{Name: xml.Name{Local: rawName(a.Name)}, Value: a.Value}
+			}
+			t.Attr = attrs
+			tok = t
+		case xml.EndElement:
+			tok = xml.EndElement{Name: xml.Name{Local: rawName(t.Name)}}
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) == 0 {
+				continue
+			}
+		}
+		if err := enc.EncodeToken(tok); err != nil {
+			return "", err
+		}
+		if _, ok := tok.(xml.ProcInst); ok {
+			// The encoder doesn't break the line after a declaration
+			if err := enc.Flush(); err != nil {
+				return "", err
+			}
+			out.WriteByte('\n')
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		return "", err
+	}
+	if out.Len() == 0 {
+		return "", errors.New("empty document")
+	}
+	return out.String(), nil
+}